@@ -0,0 +1,9 @@
+package blockchain
+
+/* AccountNonce() is the number of transactions the account sent in the blockchain, the nonce of its next transaction */
+func (b *Blockchain) AccountNonce(address *HashBlock) uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.loadState().Nonce(address)
+}
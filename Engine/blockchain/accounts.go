@@ -2,29 +2,26 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/binary"
-	"encoding/json"
 	"engine/database"
-	"engine/utils"
 	"errors"
 	"fmt"
-	"time"
-
-	"golang.org/x/crypto/sha3"
+	"io"
 )
 
 type (
 	Account struct {
-		Label      [64]byte   `json:"label"`
-		Address    HashBlock  `json:"address"`
-		CreateTime uint64     `json:"create_time"`
-		Balance    float64    `json:"balance"`
-		PublicKey  [8192]byte `json:"public_key"`
-		PrivateKey [8192]byte `json:"private_key"`
+		Label      [64]byte  `json:"label"`
+		Address    HashBlock `json:"address"`
+		CreateTime uint64    `json:"create_time"`
+		PublicKey  []byte    `json:"public_key"` // Key type byte followed by the key. The private key is kept in the keystore
+	}
+
+	/* Fixed part of the account records in accounts.dat, followed by the public key prefixed by its length */
+	accountHeader struct {
+		Label      [64]byte
+		Address    HashBlock
+		CreateTime uint64
 	}
 )
 
@@ -45,79 +42,83 @@ func (a *Account) Equals(b *Account) bool {
 	return false
 }
 
-func NewAccount(label string) (result *Account, err error) {
-	if len(label) == 0 || len(label) > 64 {
-		return nil, errors.New("account label has invalid length. Maximum length is 64 characters")
+/* NewAccount() derives the next account of the HD wallet, keeping its private key in the keystore encrypted with the passphrase */
+func NewAccount(label string, passphrase string) (result *Account, err error) {
+	wallet, err := loadHDWallet()
+	if err != nil {
+		return nil, err
 	}
 
-	newAddress := utils.NewRandomHash()
-	publicKey, privateKey := utils.GenerateRSAKeyPair(2048)
-
-	result = &Account{
-		Address:    newAddress,
-		CreateTime: uint64(time.Now().Unix()),
+	seed, err := wallet.seed(passphrase)
+	if err != nil {
+		return nil, err
 	}
 
-	copy(result.Label[:], []byte(label))
-	copy(result.PublicKey[:], publicKey)
-	copy(result.PrivateKey[:], privateKey)
-
-	err = result.Persist()
+	result, err = deriveAccount(seed, wallet.NextIndex, label, passphrase)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, err
+	wallet.NextIndex++
+
+	return result, wallet.save()
 }
 
+/* SignWithPrivateKey() signs with the private key of the account, which must be unlocked in the keystore */
 func (a *Account) SignWithPrivateKey(dataToSign []byte, accAddress string) (result []byte, err error) {
 
-	db := &database.DatabaseFile{}
-	err = db.Open(database.AccountsFileName)
-	defer db.Close()
+	account, err := a.GetAccount(accAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	bytesAccAddress, err := utils.DecodeHexString(accAddress)
+	return Wallet().Sign(&account.Address, dataToSign)
+}
 
-	prvKey, err := db.FindData(func(data []byte) []byte {
+/* VerifySignature() checks the signature was created by the private key of the account */
+func (a *Account) VerifySignature(signedData []byte, signature []byte) (err error) {
+	return verifySignature(a.PublicKey, signedData, signature)
+}
 
-		decData, err := utils.AESGCMDecrypt(data)
-		if err != nil {
-			fmt.Printf("%s\r\n", err.Error())
-			return nil
-		}
+/* KeyType() is the type of the account keys */
+func (a *Account) KeyType() KeyType {
+	keyType, _, _ := splitKey(a.PublicKey)
+	return keyType
+}
 
-		acc := &Account{}
-		err = json.Unmarshal(decData, acc)
+/* Bytes() serializes the account as a record of accounts.dat */
+func (a *Account) Bytes() []byte {
+	buff := &bytes.Buffer{}
+	binary.Write(buff, binary.LittleEndian, &accountHeader{Label: a.Label, Address: a.Address, CreateTime: a.CreateTime})
 
-		if err != nil {
-			fmt.Println(err.Error())
-			return nil
-		}
+	binary.Write(buff, binary.LittleEndian, uint16(len(a.PublicKey)))
+	buff.Write(a.PublicKey)
 
-		if acc.Address.CompareBytes(bytesAccAddress) == 0 {
-			return decData
-		}
+	return buff.Bytes()
+}
 
-		return nil
-	})
+/* FromBytes() reads an account record of accounts.dat */
+func (a *Account) FromBytes(data []byte) (err error) {
+	buff := bytes.NewReader(data)
+	header := accountHeader{}
 
-	rsaPrvKey, err := x509.ParsePKCS1PrivateKey(prvKey)
-	if err != nil {
-		return nil, err
+	if err = binary.Read(buff, binary.LittleEndian, &header); err != nil {
+		return err
 	}
 
-	hash := sha3.New256()
-	hash.Write(dataToSign)
+	size := uint16(0)
+	if err = binary.Read(buff, binary.LittleEndian, &size); err != nil {
+		return err
+	}
 
-	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaPrvKey, crypto.SHA256, hash.Sum(nil))
-	if err != nil {
-		return nil, err
+	publicKey := make([]byte, size)
+	if _, err = io.ReadFull(buff, publicKey); err != nil {
+		return err
 	}
 
-	return signature, err
+	a.Label, a.Address, a.CreateTime, a.PublicKey = header.Label, header.Address, header.CreateTime, publicKey
+
+	return nil
 }
 
 func (a *Account) LoadAccountsDatabase() (result []Account) {
@@ -125,15 +126,16 @@ func (a *Account) LoadAccountsDatabase() (result []Account) {
 	db.Open(database.AccountsFileName)
 	defer db.Close()
 
+	if err := migrateAccounts(&db); err != nil {
+		fmt.Println(err.Error())
+	}
+
 	result = make([]Account, 0)
 	db.ForEach(func(data []byte) {
 		account := Account{}
-
-		buff := &bytes.Buffer{}
-		buff.Write(data)
-		err := binary.Read(buff, binary.LittleEndian, &account)
-		if err != nil {
+		if err := account.FromBytes(data); err != nil {
 			fmt.Println(err.Error())
+			return
 		}
 		result = append(result, account)
 	})
@@ -152,24 +154,18 @@ func (a *Account) Persist() (err error) {
 	if err != nil && !errors.Is(err, database.ErrEmpty) {
 		return err
 	}
-	buff := &bytes.Buffer{}
-	err = binary.Write(buff, binary.LittleEndian, a)
-
-	hashString := utils.EncodeHexString(a.Address[:])
-	account, err := a.GetAccount(hashString)
+	account, err := FindAccount(&a.Address)
 	if errors.Is(err, ErrAccountNotFound) {
 		AccountCache = append(AccountCache, *a)
-		return db.Write(buff.Bytes())
+		return db.Write(a.Bytes())
 	}
 
 	*account = *a
-	db.Update(buff.Bytes(), func(data []byte) bool {
+	db.Update(a.Bytes(), func(data []byte) bool {
 		acc := &Account{}
-		buff := &bytes.Buffer{}
-		buff.Write(data)
-		binary.Read(buff, binary.LittleEndian, acc)
+		acc.FromBytes(data)
 
-		if bytes.Compare(acc.Label[:], a.Label[:]) == 0 {
+		if bytes.Equal(acc.Address[:], a.Address[:]) {
 			return true
 		}
 		return false
@@ -182,23 +178,28 @@ func (a *Account) CheckIntegrity() (err error) {
 	return err
 }
 
+/* GetAccount() searches the local accounts by the bech32 address typed by the user */
 func (a *Account) GetAccount(address string) (result *Account, err error) {
-	if len(AccountCache) == 0 {
-		AccountCache = a.LoadAccountsDatabase()
-	}
-
-	hash, err := utils.DecodeHexString(address)
+	hash, err := ParseAddress(address)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, account := range AccountCache {
-		if account.Address.Compare((*HashBlock)(hash)) == 0 {
-			return &account, nil
+	return FindAccount(&hash)
+}
+
+func FindAccount(address *HashBlock) (result *Account, err error) {
+	if len(AccountCache) == 0 {
+		AccountCache = (&Account{}).LoadAccountsDatabase()
+	}
+
+	for i := range AccountCache {
+		if AccountCache[i].Address.Equal(address) {
+			return &AccountCache[i], nil
 		}
 	}
 
-	return result, ErrAccountNotFound
+	return nil, ErrAccountNotFound
 }
 
 func (a *Account) ListAll() {
@@ -206,19 +207,8 @@ func (a *Account) ListAll() {
 		AccountCache = a.LoadAccountsDatabase()
 	}
 
+	bc := &Blockchain{}
 	for _, account := range AccountCache {
-		fmt.Printf("Address: 0x%x Balance: %0.8f\r\n", account.Address, account.Balance)
+		fmt.Printf("Address: %s Key: %s Balance: %s\r\n", account.EncodedAddress(), account.KeyType(), bc.Balance(&account.Address))
 	}
 }
-
-func Airdrop(to string, ammount float64) (result *Account, err error) {
-	result, err = (&Account{}).GetAccount(to)
-	if err != nil {
-		return nil, err
-	}
-
-	result.Balance += ammount
-	result.Persist()
-
-	return result, err
-}
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"engine/utils"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+/* AddressFromPublicKey() derives the account address from the hash of its public key. The key type byte is hashed too, so each key type has its own addresses */
+func AddressFromPublicKey(publicKey []byte) (result HashBlock) {
+	hash := sha3.New256()
+	hash.Write(publicKey)
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* EncodeAddress() returns the bech32 form of the address with the prefix of the network, like hsn1... */
+func EncodeAddress(address *HashBlock) string {
+	result, _ := utils.Bech32Encode(Net().AddressPrefix, address[:])
+	return result
+}
+
+/* ParseAddress() decodes an address typed by the user, rejecting the ones with a wrong checksum or network prefix */
+func ParseAddress(str string) (result HashBlock, err error) {
+	prefix, data, err := utils.Bech32Decode(str)
+	if err != nil {
+		return result, fmt.Errorf("%w \"%s\": %s", ErrInvalidAddress, str, err.Error())
+	}
+
+	if prefix != Net().AddressPrefix {
+		return result, fmt.Errorf("%w \"%s\": expected the prefix \"%s\"", ErrAddressNetwork, str, Net().AddressPrefix)
+	}
+
+	if len(data) != len(result) {
+		return result, fmt.Errorf("%w \"%s\"", ErrInvalidAddress, str)
+	}
+
+	result.SetBytes(data)
+	return result, nil
+}
+
+/* EncodedAddress() is the bech32 form of the address, used to display it */
+func (a *Account) EncodedAddress() string {
+	return EncodeAddress(&a.Address)
+}
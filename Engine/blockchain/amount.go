@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	CoinDecimals = 8
+	CoinUnits    = 100000000 // Number of base units in one coin
+)
+
+/* Amount of coins as an integer number of base units */
+type Amount int64
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	result := a + b
+	if (b > 0 && result < a) || (b < 0 && result > a) {
+		return 0, ErrAmountOverflow
+	}
+	return result, nil
+}
+
+func (a Amount) Sub(b Amount) (Amount, error) {
+	result := a - b
+	if (b > 0 && result > a) || (b < 0 && result < a) {
+		return 0, ErrAmountOverflow
+	}
+	return result, nil
+}
+
+func (a Amount) Mul(n int64) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+
+	result := a * Amount(n)
+	if result/Amount(n) != a || (a == -1 && n == math.MinInt64) || (n == -1 && a == math.MinInt64) {
+		return 0, ErrAmountOverflow
+	}
+	return result, nil
+}
+
+/* ParseAmount() converts a decimal string of coins like "12.5" into base units */
+func ParseAmount(str string) (result Amount, err error) {
+	str = strings.TrimSpace(str)
+
+	negative := strings.HasPrefix(str, "-")
+	if negative {
+		str = str[1:]
+	}
+
+	integer, fraction := str, ""
+	if pos := strings.IndexByte(str, '.'); pos >= 0 {
+		integer, fraction = str[:pos], str[pos+1:]
+	}
+
+	if len(integer)+len(fraction) == 0 || len(fraction) > CoinDecimals ||
+		strings.Trim(integer+fraction, "0123456789") != "" {
+		return 0, ErrInvalidAmount
+	}
+
+	if len(integer) == 0 {
+		integer = "0"
+	}
+
+	coins, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+
+	units, _ := strconv.ParseInt(fraction+strings.Repeat("0", CoinDecimals-len(fraction)), 10, 64)
+
+	result, err = Amount(coins).Mul(CoinUnits)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = result.Add(Amount(units))
+	if negative {
+		result = -result
+	}
+
+	return result, err
+}
+
+/* String() formats the amount in coins with all the decimal places */
+func (a Amount) String() string {
+	sign := ""
+	units := uint64(a)
+	if a < 0 {
+		sign = "-"
+		units = uint64(-a)
+	}
+
+	return fmt.Sprintf("%s%d.%08d", sign, units/CoinUnits, units%CoinUnits)
+}
+
+/* Amounts are written in json as decimal strings, and read from decimal strings or numbers */
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) (err error) {
+	*a, err = ParseAmount(strings.Trim(string(data), "\""))
+	return err
+}
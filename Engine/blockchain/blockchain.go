@@ -3,40 +3,48 @@ package blockchain
 import (
 	"encoding/json"
 	"engine/database"
-	"engine/utils"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"runtime"
+	"math"
 	"sync"
-	"time"
 )
 
 const (
-	GenesisFileName = "./db/genesis.json"
+	GenesisFileName         = "genesis.json"
+	GenesisTemplateFileName = "genesis_template.json"
 
-	mySignature = "HSN Blockchain - Developed by Hugo de Souza Novaes - hnovaes@yahoo.com"
-	Coinbase    = "0x1c6ab7bbf2e4ca7c68a2f455c6e3dcc10ad5b5a5"
-	Version     = "1.0.0"
+	Coinbase = "0x1c6ab7bbf2e4ca7c68a2f455c6e3dcc10ad5b5a5"
+	Version  = "1.0.0"
 )
 
 type (
 	Block struct {
-		Id         uint64     `json:"id"`
-		Parent     HashBlock  `json:"parent"`
-		Hash       HashBlock  `json:"hash"`
-		Nonce      NonceBlock `json:"nonce"`
-		Merkle     HashBlock  `json:"merkle"`
-		Difficulty uint64     `json:"difficulty"`
-		Time       uint64     `json:"time"`
-		Version    uint16     `json:"version"`
-		Coinbase   HashBlock  `json:"coinbase"`
+		Id           uint64     `json:"id"`
+		Parent       HashBlock  `json:"parent"`
+		Hash         HashBlock  `json:"hash"`
+		Nonce        NonceBlock `json:"nonce"`
+		Merkle       HashBlock  `json:"merkle"`
+		Difficulty   uint64     `json:"difficulty"`
+		Time         uint64     `json:"time"`
+		Version      uint16     `json:"version"`
+		Coinbase     HashBlock  `json:"coinbase"`
+		StateRoot    HashBlock  `json:"state_root"`
+		ReceiptsRoot HashBlock  `json:"receipts_root"`
+		Pruned       bool       `json:"pruned,omitempty"` // Only the header is kept, see Prune()
+
+		Transactions []Transaction `json:"transactions"`
 	}
 
 	Blockchain struct {
-		mutex                sync.Mutex
-		creatingGenesisBlock bool
-		Blocks               []Block
+		mutex          sync.Mutex
+		Blocks         []Block
+		MinerAddress   HashBlock
+		state          *LedgerState
+		undo           []*StateUndo
+		index          map[HashBlock]*BlockNode
+		reorgCallbacks []func(*ReorgEvent)
+		orphans        *OrphanPool
 	}
 )
 
@@ -44,40 +52,29 @@ func (b *Blockchain) CurrentBlock() *Block {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if b.creatingGenesisBlock {
-		return nil
-	}
-
 	b.checkAndLoadBlocks()
 	lenBlocks := len(b.Blocks)
 	return &b.Blocks[lenBlocks-1]
 }
 
-func (b *Blockchain) NewHash(newHash *HashBlock, nonce *Nonce) (*HashBlock, bool) {
+/* NewHash() adds a block mined from a template of NewBlock() to the chain */
+func (b *Blockchain) NewHash(newBlock *Block) (*HashBlock, bool) {
 
 	block := b.CurrentBlock()
 
-	cmp := newHash.Compare(&block.Hash)
-	accepted := cmp < 0
+	cmp := newBlock.Hash.Compare(&block.Hash)
+	accepted := cmp < 0 || !Params().DescendingHashes
 
 	if !accepted {
 		return nil, false
 	}
 
-	newBlock := b.NewBlock(newHash, nonce)
-
-	if newBlock == nil {
+	if err := b.AddBlock(newBlock); err != nil {
+		log.Printf("Block %d rejected: %s\r\n", newBlock.Id, err.Error())
 		return nil, false
 	}
 
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-
-	b.Blocks = append(b.Blocks, *newBlock)
-
-	b.Persist(false)
-
-	return newHash, accepted
+	return &newBlock.Hash, accepted
 }
 
 func (b *Blockchain) Persist(isGenesis bool) (err error) {
@@ -93,182 +90,242 @@ func (b *Blockchain) Persist(isGenesis bool) (err error) {
 	return dat.Add(data)
 }
 
-func (b *Blockchain) NewBlock(newHash *HashBlock, newNonce *Nonce) *Block {
+/* NewBlock() builds a block template on top of the chain tip. The miner sets the nonce and the hash */
+func (b *Blockchain) NewBlock() *Block {
 
-	var blockId uint64
-	var parentHash HashBlock
+	var lastBlock = b.CurrentBlock()
+	blockId := lastBlock.Id + 1
+	parentHash := lastBlock.Hash
 
-	if b.creatingGenesisBlock {
-		return &Block{
-			Id:         0,
-			Parent:     parentHash,
-			Hash:       *newHash,
-			Nonce:      newNonce.nonce,
-			Time:       uint64(time.Now().Unix()),
-			Difficulty: 1,
-		}
+	// The time has to exceed the median time past. When blocks come faster than that moves, wait for the clock to catch up
+	now := AdjustedTime()
+	blockTime := b.MedianTimePast() + 1
+	if blockTime > now+Params().MaxFutureDrift {
+		return nil
 	}
 
-	var lastBlock = b.CurrentBlock()
-	blockId = lastBlock.Id + 1
-	parentHash = lastBlock.Hash
+	if blockTime < now {
+		blockTime = now
+	}
 
 	newBlock := &Block{
 		Id:         blockId,
 		Parent:     parentHash,
-		Hash:       *newHash,
-		Nonce:      newNonce.nonce,
-		Time:       uint64(time.Now().Unix()),
+		Time:       blockTime,
 		Difficulty: lastBlock.Difficulty,
-		Coinbase:   lastBlock.Coinbase,
+		Coinbase:   b.MinerAddress,
 		Version:    lastBlock.Version,
 	}
 
+	// Reserve the room of a coinbase collecting the largest fees, its amount grows with them
+	coinbase := NewCoinbaseTransaction(&newBlock.Coinbase, blockId, newBlock.Time, math.MaxInt64-Params().Subsidy(blockId))
+	selected := b.selectTransactions(Params().MaxBlockSize-coinbase.Size(), blockId, newBlock.Time)
+
+	fees, _ := TotalFees(selected)
+	coinbase = NewCoinbaseTransaction(&newBlock.Coinbase, blockId, newBlock.Time, fees)
+	newBlock.Transactions = append([]Transaction{*coinbase}, selected...)
+
+	tree := &MerkleTree{}
+	if root, err := tree.BuildMarkleTree(newBlock.Transactions); err == nil {
+		newBlock.Merkle = root.Hash
+	}
+
+	stateRoot, receiptsRoot, err := b.stateRootAfter(newBlock)
+	if err != nil {
+		log.Printf("Block %d: %s\r\n", newBlock.Id, err.Error())
+		return nil
+	}
+	newBlock.StateRoot = stateRoot
+	newBlock.ReceiptsRoot = receiptsRoot
+
 	return newBlock
 }
 
-func (b *Blockchain) createGenesisHash(threaId int, wg *sync.WaitGroup, cbTestNewGenesis func(*Block) bool) {
+/* selectTransactions() picks the transactions paying the highest fee per byte that fit in maxSize, in nonce order. Locked transactions wait in the mempool */
+func (b *Blockchain) selectTransactions(maxSize int, height uint64, blockTime uint64) (result []Transaction) {
+	result = make([]Transaction, 0)
+	spendable := make(map[HashBlock]Amount)
+	gas := Params().MaxBlockGas
+	mempool := &Mempool{}
+	mempool.Prune(b.AccountNonce)
+	queues := mempool.Ready(b.AccountNonce)
+
+	for len(queues) > 0 {
+		var from HashBlock
+		var best *Transaction
+
+		for sender, queue := range queues {
+			if best == nil || queue[0].FeeRate() > best.FeeRate() ||
+				(queue[0].FeeRate() == best.FeeRate() && sender.Compare(&from) < 0) {
+				from = sender
+				best = &queue[0]
+			}
+		}
 
-	var (
-		maxHash    = &HashBlock{}
-		oldMaxHash = &HashBlock{}
-		maxNonce   = &Nonce{}
-		newHash    = &HashBlock{}
-		newNonce   = &Nonce{}
-		maxTime    = time.Now().Format(time.RFC3339)
-	)
+		transaction := *best
+		queues[from] = queues[from][1:]
+		if len(queues[from]) == 0 {
+			delete(queues, from)
+		}
 
-	defer wg.Done()
+		size := transaction.Size()
+		if size > maxSize || transaction.FeeRate() < Params().MinInclusionFeeRate || !transaction.IsFinal(height, blockTime) ||
+			transaction.CheckHTLC(height, blockTime) != nil || transaction.CheckContract() != nil || transaction.GasLimit > gas ||
+			transaction.VerifySignature() != nil {
+			delete(queues, from)
+			continue
+		}
 
-	newHash.HashString(mySignature)
-	newHash[0] = 0
-	newHash[1] = 0
-	maxHash.Set(newHash)
+		balance, ok := spendable[from]
+		if !ok {
+			balance = b.SpendableBalance(&from)
+		}
 
-	startTime := time.Now()
-	log.SetPrefix("\r")
+		total, err := transaction.Ammount.Add(transaction.Fee)
+		if err != nil || transaction.Ammount < 0 || (transaction.Ammount == 0 && !transaction.IsContract()) || balance < total {
+			delete(queues, from)
+			continue
+		}
 
-	for checkpoint := uint64(0); ; checkpoint++ {
+		spendable[from] = balance - total
+		gas -= transaction.GasLimit
+		maxSize -= size
+		result = append(result, transaction)
+	}
 
-		newNonce.Generate()
-		newHash.Sha256Nonced(newNonce)
+	return result
+}
 
-		if newHash.Compare(maxHash) > 0 && newHash[0] == 0 {
-			maxHash.Set(newHash)
-			maxNonce.Set(newNonce)
-			maxTime = time.Now().Format(time.RFC3339)
+func (b *Blockchain) GetBlock(id uint64) (*Block, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-			if !oldMaxHash.Equal(maxHash) {
-				genesis := b.NewBlock(maxHash, maxNonce)
-				accepted := cbTestNewGenesis(genesis)
-				if accepted {
-					log.SetPrefix("\r")
-					log.Printf("H:%x N:%x T:%s\r\n", maxHash[:], maxNonce.Bytes(), maxTime)
-				}
+	b.checkAndLoadBlocks()
 
-				oldMaxHash.Set(maxHash)
-			}
+	for i := range b.Blocks {
+		if b.Blocks[i].Id == id && b.Blocks[i].IsPruned() {
+			return nil, ErrBlockPruned
 		}
 
-		if checkpoint%500000 == 0 {
-			elspsedTime := time.Since(startTime)
-			fmt.Printf("\r%s", elspsedTime)
-
-			if elspsedTime.Minutes() >= 1 {
-				break
-			}
+		if b.Blocks[i].Id == id {
+			return &b.Blocks[i], nil
 		}
 	}
-}
 
-func (b *Blockchain) createGenesisBlock() error {
+	return nil, ErrBlockNotFound
+}
 
-	funcCreatingGenesisBlock := func(bc *Blockchain, status bool) {
-		bc.creatingGenesisBlock = status
+/* Validate() applies the consensus rules to the contents of the block */
+func (b *Block) Validate() error {
+	if err := b.CheckCoinbase(); err != nil {
+		return err
 	}
 
-	funcCreatingGenesisBlock(b, true)
-	defer funcCreatingGenesisBlock(b, false)
+	tree := &MerkleTree{}
+	root, err := tree.BuildMarkleTree(b.Transactions)
+	if err != nil || !root.Hash.Equal(&b.Merkle) {
+		return ErrInvalidMerkleRoot
+	}
 
-	fmt.Println("Generating Genesis Block...")
-	fmt.Println("This task will spend some time while calculating the best hash for the Genesis Block.")
+	gas := uint64(0)
+	size := 0
+	for i := range b.Transactions {
+		if size += b.Transactions[i].Size(); size > Params().MaxBlockSize {
+			return ErrBlockTooLarge
+		}
 
-	genesisFile, err := os.OpenFile(GenesisFileName, os.O_RDWR|os.O_CREATE, 0664)
-	if err != nil {
-		return err
-	}
-	defer genesisFile.Close()
+		if !b.Transactions[i].IsCoinbase() && b.Transactions[i].FeeRate() < Params().MinInclusionFeeRate {
+			return fmt.Errorf("transaction 0x%x: %w", b.Transactions[i].Hash, ErrFeeTooLow)
+		}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(runtime.NumCPU())
-	var mutex = &sync.Mutex{}
-	var targetGenesisBlock *Block
+		if err := b.Transactions[i].CheckContract(); err != nil {
+			return fmt.Errorf("transaction 0x%x: %w", b.Transactions[i].Hash, err)
+		}
 
-	for i := 0; i < runtime.NumCPU(); i++ {
+		if gas += b.Transactions[i].GasLimit; gas > Params().MaxBlockGas {
+			return ErrBlockGasLimit
+		}
 
-		go b.createGenesisHash(i, wg, func(genesis *Block) bool {
-			mutex.Lock()
-			defer mutex.Unlock()
+		if !b.Transactions[i].IsFinal(b.Id, b.Time) {
+			return fmt.Errorf("transaction 0x%x: %w", b.Transactions[i].Hash, ErrTransactionLocked)
+		}
 
-			if targetGenesisBlock == nil {
-				targetGenesisBlock = genesis
-				return true
-			}
+		if err := b.Transactions[i].CheckHTLC(b.Id, b.Time); err != nil {
+			return fmt.Errorf("transaction 0x%x: %w", b.Transactions[i].Hash, err)
+		}
 
-			hashNewBlock := genesis.Hash
-			hashTargetBlock := &targetGenesisBlock.Hash
+		if err := b.Transactions[i].VerifySignature(); err != nil {
+			return fmt.Errorf("transaction 0x%x: %w", b.Transactions[i].Hash, err)
+		}
+	}
 
-			var bytesNewBlockHash uint32 = uint32(hashNewBlock[2])<<24 | uint32(hashNewBlock[3])<<16 | uint32(hashNewBlock[4])<<8 | uint32(hashNewBlock[5])
-			var bytesTargetBlock uint32 = uint32(hashTargetBlock[2])<<24 | uint32(hashTargetBlock[3])<<16 | uint32(hashTargetBlock[4])<<8 | uint32(hashTargetBlock[5])
+	return nil
+}
 
-			cmp := hashNewBlock.Compare(hashTargetBlock)
-			if cmp <= 0 && bytesNewBlockHash < bytesTargetBlock {
-				return false
-			}
+/* ValidateBlock() applies the consensus rules that depend on the chain the block extends */
+func (b *Blockchain) ValidateBlock(block *Block) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-			targetGenesisBlock = genesis
+	return b.validateBlock(block)
+}
 
-			return true
-		})
+/* validateBlock() must be called with the blockchain mutex locked */
+func (b *Blockchain) validateBlock(block *Block) error {
+	if err := block.Validate(); err != nil {
+		return err
 	}
-	wg.Wait()
 
-	jstr, _ := json.Marshal(targetGenesisBlock)
-	log.Println("Genesis block created:")
-	fmt.Println(string(jstr))
+	return b.checkSpendable(block)
+}
 
-	err = os.WriteFile(GenesisFileName, jstr, 0664)
+/* Builds the merkle inclusion proof of a transaction hash within the block */
+func (b *Block) MerkleProof(txHash *HashBlock) (result *MerkleProof, err error) {
+	tree := &MerkleTree{}
+	root, err := tree.BuildMarkleTree(b.Transactions)
 	if err != nil {
-		log.Printf("Error creating a copy of %s: %s\r\n", GenesisFileName, err.Error())
+		return nil, ErrTransactionNotFound
+	}
+
+	if !root.Hash.Equal(&b.Merkle) {
+		return nil, ErrInvalidMerkleProof
 	}
 
-	b.Blocks = make([]Block, 1)
-	b.Blocks[0] = *targetGenesisBlock
+	result, err = tree.Proof(txHash)
+	if err != nil {
+		return nil, err
+	}
 
-	err = b.Persist(true)
-	return err
+	result.BlockId = b.Id
+	return result, nil
 }
 
 func (b *Blockchain) LoadBlockchainDatabase() {
-	if !utils.FileExists(GenesisFileName) || utils.FileIsEmpty(GenesisFileName) {
-		if err := b.createGenesisBlock(); err != nil {
-			log.Panicf("Cannot create file %s\r\n", GenesisFileName)
-		}
-	}
-
 	db := database.BlockDB{}
 	b.Blocks = make([]Block, 0)
 
 	err := db.Open()
-	if err != nil {
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
 		log.Panicf("Cannot open database file %s\r\n", err)
 	}
+	defer db.Close()
 
 	db.LoadData(func(data []byte) {
 		block := Block{}
 		err = json.Unmarshal(data, &block)
 		b.Blocks = append(b.Blocks, block)
 	})
+
+	if len(b.Blocks) == 0 {
+		log.Fatalf("The blockchain has no genesis block. Create it with \"engine init network:%s\"\r\n", Net().Name)
+	}
+
+	for i := range b.Blocks {
+		if err := b.Blocks[i].CheckCheckpoint(); err != nil {
+			log.Fatalf("Block %d of %s: %s. The database belongs to another chain, replace it with \"engine init network:%s\"\r\n",
+				b.Blocks[i].Id, database.BlocksFileName, err.Error(), Net().Name)
+		}
+	}
 }
 
 func (b *Blockchain) checkAndLoadBlocks() {
@@ -279,3 +336,34 @@ func (b *Blockchain) checkAndLoadBlocks() {
 
 	b.LoadBlockchainDatabase()
 }
+
+/* Refresh() drops the loaded chain when another process changed the tip of blocks.dat, so a long running process sees the new blocks */
+func (b *Blockchain) Refresh() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.Blocks) == 0 {
+		return
+	}
+
+	db := database.BlockDB{}
+	if err := db.Open(); err != nil {
+		return
+	}
+	defer db.Close()
+
+	data, err := db.Last()
+	if err != nil {
+		return
+	}
+
+	last := Block{}
+	if json.Unmarshal(data, &last) == nil && last.Hash.Equal(&b.Blocks[len(b.Blocks)-1].Hash) {
+		return
+	}
+
+	b.Blocks = nil
+	b.state = nil
+	b.undo = nil
+	b.index = nil
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/utils"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	checkpoints     map[uint64]HashBlock
+	checkpointsOnce sync.Once
+)
+
+/* Checkpoints() returns the block hashes any chain of the network must have: the ones of the network and the ones added in checkpoints.json */
+func Checkpoints() map[uint64]HashBlock {
+	checkpointsOnce.Do(func() {
+		entries := make(map[uint64]string)
+		for height, hash := range Net().Checkpoints {
+			entries[height] = hash
+		}
+
+		fileName := Net().ConfigFile(CheckpointsFileName)
+		if utils.FileExists(fileName) {
+			data, err := os.ReadFile(fileName)
+			if err == nil {
+				err = json.Unmarshal(data, &entries)
+			}
+
+			if err != nil {
+				log.Panicf("Error loading %s: %s\r\n", fileName, err.Error())
+			}
+		}
+
+		checkpoints = make(map[uint64]HashBlock)
+		for height, hash := range entries {
+			result := HashBlock{}
+			if len(strings.TrimPrefix(hash, "0x")) != 2*len(result) {
+				log.Panicf("Invalid checkpoint of block %d: the hash must have %d hex digits\r\n", height, 2*len(result))
+			}
+
+			if err := result.SetHexString(hash); err != nil {
+				log.Panicf("Invalid checkpoint of block %d: %s\r\n", height, err.Error())
+			}
+			checkpoints[height] = result
+		}
+	})
+
+	return checkpoints
+}
+
+/* CheckCheckpoint() verifies the block matches the checkpoint of its height, when there is one */
+func (b *Block) CheckCheckpoint() error {
+	if hash, ok := Checkpoints()[b.Id]; ok && !hash.Equal(&b.Hash) {
+		return ErrCheckpointMismatch
+	}
+
+	return nil
+}
+
+/* LastCheckpoint() is the height of the highest checkpoint within a chain of "count" blocks. Nothing at or below it can be replaced */
+func LastCheckpoint(count uint64) (result uint64, ok bool) {
+	for height := range Checkpoints() {
+		if height < count && (!ok || height > result) {
+			result, ok = height, true
+		}
+	}
+
+	return result, ok
+}
+
+/* belowCheckpoint() tells whether replacing the block "id" would rewrite the chain below its latest checkpoint. Needs the mutex locked */
+func (b *Blockchain) belowCheckpoint(id uint64) bool {
+	last, ok := LastCheckpoint(uint64(len(b.Blocks)))
+	return ok && id <= last
+}
@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"engine/utils"
+)
+
+/* Address used as the sender of the coinbase transactions */
+func CoinbaseAddress() (result HashBlock) {
+	result.SetHexString(Coinbase)
+	return result
+}
+
+func (t *Transaction) IsCoinbase() bool {
+	coinbase := CoinbaseAddress()
+	return t.From.Equal(&coinbase)
+}
+
+/* Creates the transaction paying the block reward of the given height plus the collected fees to the miner */
+func NewCoinbaseTransaction(to *HashBlock, height uint64, blockTime uint64, fees Amount) *Transaction {
+	result := &Transaction{
+		ID:         utils.NewRandomHash(),
+		From:       CoinbaseAddress(),
+		To:         *to,
+		CreateTime: blockTime,
+	}
+
+	result.Ammount, _ = Params().Subsidy(height).Add(fees)
+	result.Hash.Set(result.GetHash())
+
+	return result
+}
+
+/* CheckCoinbase() verifies the block starts with a coinbase paying no more than the subsidy plus fees */
+func (b *Block) CheckCoinbase() error {
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return ErrInvalidCoinbase
+	}
+
+	coinbase := &b.Transactions[0]
+	fees, err := TotalFees(b.Transactions[1:])
+	if err != nil {
+		return err
+	}
+
+	reward, err := Params().Subsidy(b.Id).Add(fees)
+	if err != nil || !coinbase.To.Equal(&b.Coinbase) || coinbase.Ammount < 0 || coinbase.Ammount > reward {
+		return ErrInvalidCoinbase
+	}
+
+	for i := 1; i < len(b.Transactions); i++ {
+		if b.Transactions[i].IsCoinbase() {
+			return ErrInvalidCoinbase
+		}
+	}
+
+	return nil
+}
+
+/* ImmatureRewards() sums the rewards paid to address that are still inside the maturity window */
+func (b *Blockchain) ImmatureRewards(address *HashBlock) Amount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+
+	return b.immatureRewards(address)
+}
+
+/* immatureRewards() must be called with the blockchain mutex locked */
+func (b *Blockchain) immatureRewards(address *HashBlock) (result Amount) {
+	maturity := Params().CoinbaseMaturity
+	first := 0
+	if uint64(len(b.Blocks)) > maturity {
+		first = len(b.Blocks) - int(maturity)
+	}
+
+	for _, block := range b.Blocks[first:] {
+		if block.Id == 0 {
+			continue // Genesis allocations are spendable at once
+		}
+
+		for _, transaction := range block.Transactions {
+			if transaction.IsCoinbase() && transaction.To.Equal(address) {
+				result, _ = result.Add(transaction.Ammount)
+			}
+		}
+	}
+
+	return result
+}
+
+/* SpendableBalance() is the account balance without the immature block rewards */
+func (b *Blockchain) SpendableBalance(address *HashBlock) Amount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.spendableBalance(address)
+}
+
+/* spendableBalance() must be called with the blockchain mutex locked */
+func (b *Blockchain) spendableBalance(address *HashBlock) Amount {
+	result, err := b.loadState().Balance(address).Sub(b.immatureRewards(address))
+	if err != nil || result < 0 {
+		return 0
+	}
+	return result
+}
+
+/* checkSpendable() verifies the senders of the block do not spend immature block rewards. Needs the mutex locked */
+func (b *Blockchain) checkSpendable(block *Block) error {
+	spent := make(map[HashBlock]Amount)
+
+	for _, transaction := range block.Transactions {
+		if transaction.IsCoinbase() {
+			continue
+		}
+
+		total, err := transaction.Ammount.Add(transaction.Fee)
+		if err == nil {
+			total, err = spent[transaction.From].Add(total)
+		}
+		if err != nil {
+			return err
+		}
+
+		if total > b.loadState().Balance(&transaction.From) {
+			return ErrInsufficientFunds
+		}
+
+		if total > b.spendableBalance(&transaction.From) {
+			return ErrImmatureFunds
+		}
+		spent[transaction.From] = total
+	}
+
+	return nil
+}
@@ -3,11 +3,81 @@ package blockchain
 import "errors"
 
 const (
-	ConfigFileName = "./nodeconfig.json"
+	ConfigFileName      = "nodeconfig.json"
+	MinerConfigFileName = "minerconfig.json"
+	ChainParamsFileName = "chainparams.json"
+	CheckpointsFileName = "checkpoints.json"
 )
 
 var (
-	ErrAccountNotFound   = errors.New("account does not exist")
-	ErrInsufficientFunds = errors.New("insufficient funds to transfer")
-	ErrNoTransactions    = errors.New("transactions list is empty")
+	ErrAccountNotFound        = errors.New("account does not exist")
+	ErrInsufficientFunds      = errors.New("insufficient funds to transfer")
+	ErrNoTransactions         = errors.New("transactions list is empty")
+	ErrBlockNotFound          = errors.New("block does not exist")
+	ErrTransactionNotFound    = errors.New("transaction is not part of the block")
+	ErrInvalidMerkleProof     = errors.New("merkle proof does not match the block merkle root")
+	ErrInvalidCoinbase        = errors.New("block coinbase transaction is missing or pays more than allowed")
+	ErrImmatureFunds          = errors.New("funds from block rewards are not mature yet")
+	ErrFeeTooLow              = errors.New("transaction fee is below the minimum fee rate")
+	ErrBlockTooLarge          = errors.New("block transactions exceed the maximum block size")
+	ErrUnsignedTransaction    = errors.New("transaction is not signed by the sender")
+	ErrInvalidSignature       = errors.New("transaction signature does not match the sender public key")
+	ErrInvalidTransactionHash = errors.New("transaction hash does not match its contents")
+	ErrNonceUsed              = errors.New("transaction nonce was already used by the account")
+	ErrNonceGap               = errors.New("transaction nonce skips the next nonce of the account")
+	ErrDuplicateNonce         = errors.New("a transaction with the same nonce is already pending")
+	ErrInvalidAmount          = errors.New("invalid ammount")
+	ErrAmountOverflow         = errors.New("ammount is out of range")
+	ErrStateOutOfOrder        = errors.New("block does not follow the last block applied to the ledger state")
+	ErrDisconnectGenesis      = errors.New("the genesis block cannot be disconnected")
+	ErrInvalidStateRoot       = errors.New("block state root does not match the ledger state")
+	ErrInvalidReceiptsRoot    = errors.New("block receipts root does not match the receipts of its transactions")
+	ErrBlockTimeTooOld        = errors.New("block time is not after the median time of the previous blocks")
+	ErrBlockTimeTooNew        = errors.New("block time is too far ahead of the network adjusted time")
+	ErrBlockPruned            = errors.New("the transactions of the block were pruned, only its header is kept")
+	ErrCheckpointMismatch     = errors.New("block hash does not match the checkpoint of its height")
+	ErrBelowCheckpoint        = errors.New("the chain cannot be changed at or below its latest checkpoint")
+	ErrHeaderNotFound         = errors.New("the light client has no header of the block")
+	ErrProofMismatch          = errors.New("the transaction does not match the hash of the proof")
+	ErrPruneTooDeep           = errors.New("pruning must keep the blocks needed by reorganisations, coinbase maturity and fee estimation")
+	ErrInvalidBalanceProof    = errors.New("balance proof does not match the block state root")
+	ErrInvalidMerkleRoot      = errors.New("block merkle root does not match its transactions")
+	ErrInvalidParent          = errors.New("block does not follow its parent")
+	ErrInvalidProofOfWork     = errors.New("block hash does not meet the proof of work rules")
+	ErrBlockKnown             = errors.New("block is already in the block tree")
+	ErrOrphanBlock            = errors.New("parent of the block is unknown")
+	ErrReorgTooDeep           = errors.New("reorganisation is deeper than the maximum reorg depth")
+	ErrChainInitialized       = errors.New("the blockchain database already has a genesis block")
+	ErrGenesisMismatch        = errors.New("genesis hash does not match the hash of the template")
+	ErrUnknownNetwork         = errors.New("network does not exist. Use main, test or regtest")
+	ErrWrongNetwork           = errors.New("pack belongs to another network")
+	ErrInvalidAddress         = errors.New("invalid address")
+	ErrAddressNetwork         = errors.New("address belongs to another network")
+	ErrInvalidPublicKey       = errors.New("transaction public key does not match the sender address")
+	ErrUnknownKeyType         = errors.New("unknown or malformed key type")
+	ErrKeyNotFound            = errors.New("the keystore has no private key for the account")
+	ErrKeystoreFormat         = errors.New("keystore file uses an unknown format")
+	ErrWrongPassphrase        = errors.New("wrong passphrase")
+	ErrWalletLocked           = errors.New("account is locked. Unlock it with its passphrase")
+	ErrNoHDWallet             = errors.New("the HD wallet was not created yet")
+	ErrWalletExists           = errors.New("the keystore already has an HD wallet with another seed")
+	ErrInvalidHDPath          = errors.New("invalid HD derivation path. Ed25519 keys only have hardened children, like m/44'/0'")
+	ErrInvalidMultisig        = errors.New("invalid multisig key. The threshold must be between 1 and the number of distinct keys")
+	ErrMultisigAccount        = errors.New("multisig accounts send partially signed transactions. Use createpartial")
+	ErrNotASigner             = errors.New("the account is not a signer of the multisig account")
+	ErrThresholdNotMet        = errors.New("the transaction does not have the signatures required by the multisig threshold")
+	ErrTransactionLocked      = errors.New("transaction lock time is not reached yet")
+	ErrInvalidLockTime        = errors.New("invalid lock time. Inform a block height, a Unix time or a date like 2026-01-01T00:00:00Z")
+	ErrInvalidHTLC            = errors.New("invalid hash time-locked contract")
+	ErrInvalidPreimage        = errors.New("the preimage does not match the hash lock of the contract")
+	ErrHTLCExpired            = errors.New("the contract deadline has passed, the funds can only be refunded")
+	ErrHTLCNotExpired         = errors.New("the contract deadline has not passed yet, the funds can only be claimed")
+	ErrHTLCEmpty              = errors.New("the contract has no locked funds")
+	ErrInvalidContractTx      = errors.New("invalid contract transaction. A deployment needs the code and a call needs an input, both with a gas limit")
+	ErrGasLimit               = errors.New("transaction gas limit is above the maximum")
+	ErrGasFeeTooLow           = errors.New("transaction fee does not pay for its gas limit at the gas price")
+	ErrBlockGasLimit          = errors.New("block transactions exceed the block gas limit")
+	ErrContractNotFound       = errors.New("there is no contract at the address")
+	ErrReceiptNotFound        = errors.New("there is no receipt of the transaction in the blockchain")
+	ErrNoMinerWallet          = errors.New("miner wallet is not configured in minerconfig.json")
 )
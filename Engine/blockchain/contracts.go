@@ -0,0 +1,273 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"engine/utils"
+	"engine/vm"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+/* Gas limit of the deployments and calls when not informed */
+const DefaultGasLimit = 100000
+
+/* ContractAddress() is the address of the contract deployed by the transaction of the sender with the nonce */
+func ContractAddress(from *HashBlock, nonce uint64) (result HashBlock) {
+	hash := sha3.New256()
+	hash.Write(from[:])
+	hash.Write(utils.Uint64ToBytes(nonce))
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* IsContract() tells whether the transaction runs contract code: a deployment or a call */
+func (t *Transaction) IsContract() bool {
+	return t.GasLimit > 0
+}
+
+/* IsDeployment() tells whether the transaction creates a contract with the code in its data */
+func (t *Transaction) IsDeployment() bool {
+	empty := HashBlock{}
+	return t.IsContract() && t.To.Equal(&empty)
+}
+
+/* CheckContract() applies the rules of the contract transactions: code or input sizes, gas limit and a fee paying for the gas */
+func (t *Transaction) CheckContract() error {
+	if !t.IsContract() {
+		if len(t.Data) > 0 {
+			return ErrInvalidContractTx
+		}
+		return nil
+	}
+
+	if t.IsCoinbase() || len(t.Data) == 0 {
+		return ErrInvalidContractTx
+	}
+
+	// The code runs once with an empty input when deployed, so an empty input always means a deployment
+	if (t.IsDeployment() && len(t.Data) > vm.MaxCodeSize) || (!t.IsDeployment() && len(t.Data) > vm.MaxInputSize) {
+		return ErrInvalidContractTx
+	}
+
+	if t.GasLimit > Params().MaxTransactionGas {
+		return ErrGasLimit
+	}
+
+	gasFee, err := Params().GasPrice.Mul(int64(t.GasLimit))
+	if err != nil || gasFee > t.Fee {
+		return ErrGasFeeTooLow
+	}
+
+	return nil
+}
+
+/* Balance() and Load() give the code read access to the state with the changes of the block so far */
+func (c *stateChanges) Balance(address vm.Word) uint64 {
+	return uint64(c.balance(HashBlock(address)))
+}
+
+func (c *stateChanges) Load(contract vm.Word, key vm.Word) vm.Word {
+	return vm.Word(c.load(HashBlock(contract), HashBlock(key)))
+}
+
+/* execute() runs the code of a contract transaction whose sender already paid the ammount and the fee. When it fails, only the ammount is returned */
+func (c *stateChanges) execute(transaction *Transaction, block *Block) (receipt *Receipt, err error) {
+	receipt = &Receipt{Transaction: transaction.ID, Logs: make([]ReceiptLog, 0)}
+
+	contract, code, input := transaction.To, c.contractCode(transaction.To), transaction.Data
+	if transaction.IsDeployment() {
+		contract, code, input = ContractAddress(&transaction.From, transaction.Nonce), transaction.Data, nil
+		receipt.Contract = &contract
+	}
+
+	result := &vm.Result{GasUsed: transaction.GasLimit, Err: vm.ErrOutOfGas}
+	if intrinsic := vm.IntrinsicGas(transaction.IsDeployment(), transaction.Data); intrinsic <= transaction.GasLimit {
+		result = vm.Execute(code, &vm.Context{
+			Address: vm.Word(contract),
+			Caller:  vm.Word(transaction.From),
+			Value:   uint64(transaction.Ammount),
+			Input:   input,
+			Height:  block.Id,
+			Time:    block.Time,
+			Gas:     transaction.GasLimit - intrinsic,
+		}, c)
+		result.GasUsed += intrinsic
+	}
+
+	receipt.GasUsed = result.GasUsed
+	receipt.Return = result.Return
+
+	if result.Err != nil {
+		receipt.Error = result.Err.Error()
+		return receipt, c.credit(transaction.From, transaction.Ammount)
+	}
+
+	receipt.Status = ReceiptSuccess
+	if transaction.IsDeployment() {
+		c.code[contract] = code
+	}
+
+	if err = c.credit(contract, transaction.Ammount); err != nil {
+		return nil, err
+	}
+
+	for key, value := range result.Storage {
+		c.store(contract, HashBlock(key), HashBlock(value))
+	}
+
+	for _, transfer := range result.Transfers {
+		balance, err := c.balance(contract).Sub(Amount(transfer.Ammount))
+		if err != nil || balance < 0 {
+			return nil, ErrInsufficientFunds
+		}
+		c.balances[contract] = balance
+
+		if err = c.credit(HashBlock(transfer.To), Amount(transfer.Ammount)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, log := range result.Logs {
+		entry := ReceiptLog{Address: HashBlock(log.Address), Data: HashBlock(log.Data), Topics: make([]HashBlock, 0, len(log.Topics))}
+		for _, topic := range log.Topics {
+			entry.Topics = append(entry.Topics, HashBlock(topic))
+		}
+		receipt.Logs = append(receipt.Logs, entry)
+	}
+
+	return receipt, nil
+}
+
+/* NewContractTransaction() deploys the code in data when "to" is empty, or calls the contract at "to" with data as the input */
+func (b *Blockchain) NewContractTransaction(from string, to string, ammount Amount, fee Amount, gasLimit uint64, data []byte) (result *Transaction, err error) {
+	account := Account{}
+
+	accountFrom, err := account.GetAccount(from)
+	if err != nil {
+		return nil, err
+	}
+
+	if accountFrom.KeyType() == KeyTypeMultisig {
+		return nil, ErrMultisigAccount
+	}
+
+	if gasLimit == 0 {
+		return nil, ErrInvalidContractTx
+	}
+
+	result = &Transaction{Ammount: ammount, Fee: fee, GasLimit: gasLimit, Data: data}
+	if len(to) > 0 {
+		if result.To, err = ParseAddress(to); err != nil {
+			return nil, err
+		}
+	}
+
+	if ammount < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if err = result.CheckContract(); err != nil {
+		return nil, err
+	}
+
+	if result, err = newTransaction(b, accountFrom, result); err != nil {
+		return nil, err
+	}
+
+	result.Signature, err = account.SignWithPrivateKey(result.Hash[:], from)
+	if err != nil {
+		return nil, err
+	}
+
+	err = (&Mempool{}).Add(result, b.AccountNonce)
+
+	return result, err
+}
+
+/* EstimateContractFee() suggests the fee of a contract transaction: the fee for its size plus the gas limit at the gas price */
+func (b *Blockchain) EstimateContractFee(keyType KeyType, data []byte, gasLimit uint64) (Amount, error) {
+	publicKeySize, signatureSize := keyType.KeySizes()
+
+	gasFee, err := Params().GasPrice.Mul(int64(gasLimit))
+	if err != nil {
+		return 0, err
+	}
+
+	return b.estimateFee(publicKeySize, signatureSize, len(data), gasLimit).Add(gasFee)
+}
+
+/* QueryContract() runs the contract with the input on the current state, as a call from the caller, without changing anything */
+func (b *Blockchain) QueryContract(caller *HashBlock, contract *HashBlock, input []byte) (result *vm.Result, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := b.loadState()
+
+	code, ok := state.Code[*contract]
+	if !ok {
+		return nil, ErrContractNotFound
+	}
+
+	result = vm.Execute(code, &vm.Context{
+		Address: vm.Word(*contract),
+		Caller:  vm.Word(*caller),
+		Input:   input,
+		Height:  b.Blocks[len(b.Blocks)-1].Id + 1,
+		Time:    uint64(time.Now().Unix()),
+		Gas:     Params().MaxTransactionGas,
+	}, state.changes())
+
+	return result, nil
+}
+
+/* ContractCode() returns the code of the contract deployed at the address */
+func (b *Blockchain) ContractCode(contract *HashBlock) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	code, ok := b.loadState().Code[*contract]
+	if !ok {
+		return nil, ErrContractNotFound
+	}
+
+	return code, nil
+}
+
+/* EncodeContractInput() builds a call input from comma separated words: addresses like hsn1..., numbers, or hex values like 0xff */
+func EncodeContractInput(words string) (result []byte, err error) {
+	result = make([]byte, 0)
+
+	for _, item := range strings.Split(words, ",") {
+		item = strings.TrimSpace(item)
+		word := HashBlock{}
+
+		switch {
+		case len(item) == 0:
+			continue
+		case strings.HasPrefix(item, "0x"):
+			data, err := hex.DecodeString(strings.TrimPrefix(item, "0x"))
+			if err != nil || len(data) > len(word) {
+				return nil, ErrInvalidContractTx
+			}
+			copy(word[len(word)-len(data):], data)
+		case strings.HasPrefix(item, Net().AddressPrefix+"1"):
+			if word, err = ParseAddress(item); err != nil {
+				return nil, err
+			}
+		default:
+			value, ok := new(big.Int).SetString(item, 10)
+			if !ok || value.Sign() < 0 || value.BitLen() > 256 {
+				return nil, ErrInvalidContractTx
+			}
+			value.FillBytes(word[:])
+		}
+
+		result = append(result, word[:]...)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+/* Size() is the number of bytes the transaction takes inside a block */
+func (t *Transaction) Size() int {
+	data, _ := json.Marshal(t)
+	return len(data)
+}
+
+/* FeeRate() is the fee paid per byte of the transaction */
+func (t *Transaction) FeeRate() Amount {
+	return t.Fee / Amount(t.Size())
+}
+
+func TotalFees(transactions []Transaction) (result Amount, err error) {
+	for _, transaction := range transactions {
+		result, err = result.Add(transaction.Fee)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+/* EstimateFeeRate() suggests a fee per byte from the median fee rate paid in the recent blocks */
+func (b *Blockchain) EstimateFeeRate() Amount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+
+	minimum := Params().MinRelayFeeRate
+	if Params().MinInclusionFeeRate > minimum {
+		minimum = Params().MinInclusionFeeRate
+	}
+
+	first := len(b.Blocks) - Params().FeeEstimateBlocks
+	if first < 0 {
+		first = 0
+	}
+
+	rates := make([]Amount, 0)
+	for _, block := range b.Blocks[first:] {
+		for _, transaction := range block.Transactions {
+			if !transaction.IsCoinbase() {
+				rates = append(rates, transaction.FeeRate())
+			}
+		}
+	}
+
+	if len(rates) == 0 {
+		return minimum
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i] < rates[j]
+	})
+	median := rates[len(rates)/2]
+	if median < minimum {
+		return minimum
+	}
+
+	return median
+}
+
+/* EstimateFee() suggests the fee of a transfer between two accounts with keys of the default type */
+func (b *Blockchain) EstimateFee() Amount {
+	return b.EstimateFeeFor(DefaultKeyType)
+}
+
+/* EstimateFeeFor() suggests the fee of a transfer signed with a key of the given type */
+func (b *Blockchain) EstimateFeeFor(keyType KeyType) Amount {
+	publicKeySize, signatureSize := keyType.KeySizes()
+	return b.estimateFee(publicKeySize, signatureSize, 0, 0)
+}
+
+/* estimateFee() suggests the fee for the size of a transaction with a public key, a signature and contract data of the given sizes */
+func (b *Blockchain) estimateFee(publicKeySize int, signatureSize int, dataSize int, gasLimit uint64) Amount {
+	rate := b.EstimateFeeRate()
+
+	largest := HashBlock{}
+	for i := range largest {
+		largest[i] = 0xff
+	}
+
+	transfer := &Transaction{ID: largest, From: largest, To: largest, Hash: largest, CreateTime: uint64(time.Now().Unix()), Ammount: CoinUnits}
+	transfer.Nonce = ^uint64(0)
+	transfer.LockTime = ^uint64(0)
+	transfer.PublicKey = make([]byte, publicKeySize)
+	transfer.Signature = make([]byte, signatureSize)
+	if gasLimit > 0 {
+		transfer.GasLimit = gasLimit
+		transfer.Data = make([]byte, dataSize)
+	}
+	// The fee is written in the transaction, so the size grows with it. Repeat until the fee pays for its own digits
+	for fee := Amount(-1); fee != transfer.Fee; {
+		fee = transfer.Fee
+		transfer.Fee, _ = rate.Mul(int64(transfer.Size()))
+	}
+
+	return transfer.Fee
+}
@@ -0,0 +1,452 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/database"
+	"errors"
+	"log"
+	"math/big"
+	"sort"
+)
+
+type (
+	/* Node of the block tree. Work is the cumulative work of the block and all its ancestors */
+	BlockNode struct {
+		Block  Block
+		Parent *BlockNode
+		Work   *big.Int
+	}
+
+	/* Emitted when the best chain moves to another branch of the block tree */
+	ReorgEvent struct {
+		OldTip       HashBlock   `json:"old_tip"`
+		NewTip       HashBlock   `json:"new_tip"`
+		ForkHeight   uint64      `json:"fork_height"` // Id of the last block shared by both branches
+		Disconnected []HashBlock `json:"disconnected"`
+		Connected    []HashBlock `json:"connected"`
+	}
+)
+
+/* Work() is the expected number of hashes needed to find the block, 2^(8*difficulty) */
+func (b *Block) Work() *big.Int {
+	difficulty := b.Difficulty
+	if difficulty > uint64(len(b.Hash)) {
+		difficulty = uint64(len(b.Hash))
+	}
+
+	return new(big.Int).Lsh(big.NewInt(1), uint(8*difficulty))
+}
+
+/* CheckProofOfWork() verifies the block hash is the hash of its header and meets the rules of the parent */
+func (b *Block) CheckProofOfWork(parent *Block) error {
+	if b.Id != parent.Id+1 || !b.Parent.Equal(&parent.Hash) {
+		return ErrInvalidParent
+	}
+
+	if b.Difficulty != parent.Difficulty {
+		return ErrInvalidProofOfWork
+	}
+
+	if err := b.CheckHash(); err != nil {
+		return err
+	}
+
+	if Params().DescendingHashes && b.Hash.Compare(&parent.Hash) >= 0 {
+		return ErrInvalidProofOfWork
+	}
+
+	return nil
+}
+
+/* CheckHash() verifies the block hash is the hash of its header and meets the difficulty of the block */
+func (b *Block) CheckHash() error {
+	if b.Difficulty > uint64(len(b.Hash)) {
+		return ErrInvalidProofOfWork
+	}
+
+	if !b.GenerateHash().Equal(&b.Hash) {
+		return ErrInvalidProofOfWork
+	}
+
+	for i := uint64(0); i < b.Difficulty; i++ {
+		if b.Hash[i] != 0 {
+			return ErrInvalidProofOfWork
+		}
+	}
+
+	return nil
+}
+
+/* OnReorg() registers a function called after every reorganisation of the chain */
+func (b *Blockchain) OnReorg(callback func(*ReorgEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.reorgCallbacks = append(b.reorgCallbacks, callback)
+}
+
+/* AddBlock() inserts the block in the block tree and switches to the branch with the most cumulative work */
+func (b *Blockchain) AddBlock(block *Block) error {
+	b.mutex.Lock()
+	event, err := b.addBlock(block)
+	callbacks := b.reorgCallbacks
+	b.mutex.Unlock()
+
+	if event != nil {
+		log.Printf("Reorganisation at block %d: %d blocks disconnected, %d connected, new tip 0x%x\r\n",
+			event.ForkHeight, len(event.Disconnected), len(event.Connected), event.NewTip[:])
+
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	}
+
+	return err
+}
+
+/* addBlock() must be called with the blockchain mutex locked */
+func (b *Blockchain) addBlock(block *Block) (event *ReorgEvent, err error) {
+	b.loadIndex()
+
+	if _, known := b.index[block.Hash]; known {
+		return nil, ErrBlockKnown
+	}
+
+	if err = block.CheckCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	if b.belowCheckpoint(block.Id) {
+		return nil, ErrBelowCheckpoint
+	}
+
+	parent, ok := b.index[block.Parent]
+	if !ok {
+		return nil, ErrOrphanBlock
+	}
+
+	if err = block.CheckProofOfWork(&parent.Block); err != nil {
+		return nil, err
+	}
+
+	if err = block.CheckTimestamp(parent.MedianTimePast(), AdjustedTime()); err != nil {
+		return nil, err
+	}
+
+	if err = block.Validate(); err != nil {
+		return nil, err
+	}
+
+	node := &BlockNode{
+		Block:  *block,
+		Parent: parent,
+		Work:   new(big.Int).Add(parent.Work, block.Work()),
+	}
+
+	tip := b.tipNode()
+
+	if parent == tip {
+		if err = b.validateBlock(block); err != nil {
+			return nil, err
+		}
+
+		if err = b.connectBlock(block); err != nil {
+			return nil, err
+		}
+
+		b.index[block.Hash] = node
+		mempool := &Mempool{}
+		mempool.Remove(block.Transactions)
+		mempool.Prune(b.loadState().Nonce)
+		b.pruneSideBlocks()
+
+		return nil, nil
+	}
+
+	if err = saveSideBlock(block); err != nil {
+		return nil, err
+	}
+	b.index[block.Hash] = node
+
+	if node.Work.Cmp(tip.Work) <= 0 {
+		return nil, nil
+	}
+
+	event, err = b.reorganize(node)
+	if err == nil {
+		b.pruneSideBlocks()
+	}
+
+	return event, err
+}
+
+/* reorganize() disconnects the blocks of the best chain down to the fork and connects the branch of newTip */
+func (b *Blockchain) reorganize(newTip *BlockNode) (event *ReorgEvent, err error) {
+	branch := make([]*BlockNode, 0)
+	fork := newTip
+	for !b.isOnMainChain(fork) {
+		branch = append(branch, fork)
+		fork = fork.Parent
+	}
+
+	oldTip := b.Blocks[len(b.Blocks)-1]
+	if oldTip.Id-fork.Block.Id > Params().MaxReorgDepth {
+		return nil, ErrReorgTooDeep
+	}
+
+	if b.belowCheckpoint(fork.Block.Id + 1) {
+		return nil, ErrBelowCheckpoint
+	}
+
+	event = &ReorgEvent{
+		OldTip:       oldTip.Hash,
+		NewTip:       newTip.Block.Hash,
+		ForkHeight:   fork.Block.Id,
+		Disconnected: make([]HashBlock, 0),
+		Connected:    make([]HashBlock, 0),
+	}
+
+	disconnected, err := b.disconnectTo(fork.Block.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		block := &branch[i].Block
+
+		err = b.validateBlock(block)
+		if err == nil {
+			err = b.connectBlock(block)
+		}
+
+		if err != nil {
+			log.Printf("Block %d 0x%x rejected during the reorganisation: %s\r\n", block.Id, block.Hash[:], err.Error())
+			b.removeBranch(branch[i])
+			b.restoreChain(fork.Block.Id, disconnected)
+			return nil, err
+		}
+
+		event.Connected = append(event.Connected, block.Hash)
+	}
+
+	mempool := &Mempool{}
+	for i := range disconnected {
+		event.Disconnected = append(event.Disconnected, disconnected[i].Hash)
+
+		if err := saveSideBlock(&disconnected[i]); err != nil {
+			log.Printf("Error saving the side block %d: %s\r\n", disconnected[i].Id, err.Error())
+		}
+
+		mempool.Restore(disconnected[i].Transactions)
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		mempool.Remove(branch[i].Block.Transactions)
+	}
+	mempool.Prune(b.loadState().Nonce)
+
+	return event, nil
+}
+
+/* disconnectTo() removes the blocks above the given id, returning them from the tip down */
+func (b *Blockchain) disconnectTo(id uint64) (result []Block, err error) {
+	result = make([]Block, 0)
+
+	for b.Blocks[len(b.Blocks)-1].Id > id {
+		block, err := b.disconnectTip()
+		if err != nil {
+			return result, err
+		}
+		result = append(result, *block)
+	}
+
+	return result, nil
+}
+
+/* restoreChain() puts back the blocks disconnected by a reorganisation that failed */
+func (b *Blockchain) restoreChain(id uint64, disconnected []Block) {
+	if _, err := b.disconnectTo(id); err != nil {
+		log.Panicf("Cannot restore the chain at block %d: %s\r\n", id, err.Error())
+	}
+
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := b.connectBlock(&disconnected[i]); err != nil {
+			log.Panicf("Cannot restore block %d: %s\r\n", disconnected[i].Id, err.Error())
+		}
+	}
+}
+
+/* removeBranch() drops an invalid block and its descendants from the block tree */
+func (b *Blockchain) removeBranch(invalid *BlockNode) {
+	for hash, node := range b.index {
+		for ancestor := node; ancestor != nil; ancestor = ancestor.Parent {
+			if ancestor == invalid {
+				delete(b.index, hash)
+				break
+			}
+		}
+	}
+}
+
+/* BlockByHash() searches the block tree, so blocks of the side branches are found too */
+func (b *Blockchain) BlockByHash(hash *HashBlock) (*Block, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.loadIndex()
+
+	node, ok := b.index[*hash]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	if node.Block.IsPruned() {
+		return nil, ErrBlockPruned
+	}
+
+	result := node.Block
+	return &result, nil
+}
+
+func (b *Blockchain) isOnMainChain(node *BlockNode) bool {
+	id := node.Block.Id
+	return id < uint64(len(b.Blocks)) && b.Blocks[id].Hash.Equal(&node.Block.Hash)
+}
+
+func (b *Blockchain) tipNode() *BlockNode {
+	return b.index[b.Blocks[len(b.Blocks)-1].Hash]
+}
+
+/* loadIndex() builds the block tree from the best chain and the side blocks. Needs the mutex locked */
+func (b *Blockchain) loadIndex() {
+	b.loadState()
+
+	if b.index != nil {
+		return
+	}
+
+	b.index = make(map[HashBlock]*BlockNode)
+
+	var parent *BlockNode
+	for i := range b.Blocks {
+		node := &BlockNode{Block: b.Blocks[i], Parent: parent, Work: b.Blocks[i].Work()}
+		if parent != nil {
+			node.Work.Add(node.Work, parent.Work)
+		}
+
+		b.index[node.Block.Hash] = node
+		parent = node
+	}
+
+	sideBlocks := loadSideBlocks()
+	sort.SliceStable(sideBlocks, func(i, j int) bool {
+		return sideBlocks[i].Id < sideBlocks[j].Id
+	})
+
+	for i := range sideBlocks {
+		block := &sideBlocks[i]
+		parent, ok := b.index[block.Parent]
+		if _, known := b.index[block.Hash]; known || !ok {
+			continue
+		}
+
+		b.index[block.Hash] = &BlockNode{
+			Block:  *block,
+			Parent: parent,
+			Work:   new(big.Int).Add(parent.Work, block.Work()),
+		}
+	}
+}
+
+func saveSideBlock(block *Block) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.SideBlocksFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	return db.Write(data)
+}
+
+/* pruneSideBlocks() drops the side blocks no reorganisation can reach: too deep below the tip, at or below the latest checkpoint, or back on the best chain. Needs the mutex locked */
+func (b *Blockchain) pruneSideBlocks() {
+	tip := b.Blocks[len(b.Blocks)-1].Id
+	sideBlocks := loadSideBlocks()
+	remaining := make([]Block, 0, len(sideBlocks))
+
+	for i := range sideBlocks {
+		block := &sideBlocks[i]
+		node, indexed := b.index[block.Hash]
+		if indexed && b.isOnMainChain(node) {
+			continue
+		}
+
+		// The fork of a branch holding the block is below it, so the reorganisation would disconnect more than MaxReorgDepth blocks
+		if block.Id+Params().MaxReorgDepth <= tip || b.belowCheckpoint(block.Id) {
+			delete(b.index, block.Hash)
+			continue
+		}
+
+		remaining = append(remaining, *block)
+	}
+
+	if len(remaining) == len(sideBlocks) {
+		return
+	}
+
+	if err := replaceSideBlocks(remaining); err != nil {
+		log.Printf("Error pruning the side blocks: %s\r\n", err.Error())
+	}
+}
+
+func replaceSideBlocks(blocks []Block) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.SideBlocksFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	if err = db.Clear(); err != nil {
+		return err
+	}
+
+	for i := range blocks {
+		data, err := json.Marshal(&blocks[i])
+		if err != nil {
+			return err
+		}
+
+		if err = db.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadSideBlocks() (result []Block) {
+	db := &database.DatabaseFile{}
+	err := db.Open(database.SideBlocksFileName)
+	defer db.Close()
+
+	result = make([]Block, 0)
+	if err != nil {
+		return result
+	}
+
+	db.ForEach(func(data []byte) {
+		block := Block{}
+		if json.Unmarshal(data, &block) == nil {
+			result = append(result, block)
+		}
+	})
+
+	return result
+}
@@ -0,0 +1,278 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"engine/database"
+	"engine/utils"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+type (
+	GenesisAllocation struct {
+		Address string `json:"address"`
+		Balance Amount `json:"balance"`
+	}
+
+	/* Description of the genesis block shared by all nodes of a network */
+	GenesisTemplate struct {
+		Hash        string              `json:"hash"` // Expected genesis hash. Optional, checked when present
+		Nonce       string              `json:"nonce"`
+		Difficulty  uint64              `json:"difficulty"`
+		Time        string              `json:"time"` // RFC3339 timestamp
+		Version     uint16              `json:"version"`
+		Coinbase    string              `json:"coinbase"`
+		Allocations []GenesisAllocation `json:"allocations"`
+		Params      json.RawMessage     `json:"params"` // Chain parameters overriding the defaults
+	}
+)
+
+func LoadGenesisTemplate(fileName string) (result *GenesisTemplate, err error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &GenesisTemplate{}
+	err = json.Unmarshal(data, result)
+
+	return result, err
+}
+
+/* ChainParams() returns the parameters of the network overridden by the ones of the template */
+func (t *GenesisTemplate) ChainParams() (result *ChainParams, err error) {
+	result = Net().Params()
+
+	if len(t.Params) > 0 {
+		err = json.Unmarshal(t.Params, result)
+	}
+
+	return result, err
+}
+
+/* paramsHash() hashes the template parameters with sorted keys, so the formatting of the file does not matter */
+func (t *GenesisTemplate) paramsHash() (result HashBlock, err error) {
+	params := make(map[string]interface{})
+
+	if len(t.Params) > 0 {
+		if err = json.Unmarshal(t.Params, &params); err != nil {
+			return result, err
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return result, err
+	}
+
+	hash := sha3.New256()
+	hash.Write(data)
+	result.SetBytes(hash.Sum(nil))
+
+	return result, nil
+}
+
+/* Block() builds the genesis block. The same template always results in the same block and hash */
+func (t *GenesisTemplate) Block() (result *Block, err error) {
+	blockTime, err := time.Parse(time.RFC3339, t.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := &Nonce{}
+	if err = nonce.FromString(t.Nonce); err != nil {
+		return nil, err
+	}
+
+	result = &Block{
+		Id:           0,
+		Nonce:        nonce.nonce,
+		Difficulty:   t.Difficulty,
+		Time:         uint64(blockTime.Unix()),
+		Version:      t.Version,
+		Transactions: make([]Transaction, 0),
+	}
+
+	if len(t.Coinbase) > 0 {
+		if err = result.Coinbase.SetHexString(t.Coinbase); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, allocation := range t.Allocations {
+		transaction := Transaction{
+			From:       CoinbaseAddress(),
+			CreateTime: result.Time,
+			Ammount:    allocation.Balance,
+		}
+
+		if transaction.To, err = ParseAddress(allocation.Address); err != nil {
+			return nil, fmt.Errorf("allocation %d: %w", i, err)
+		}
+
+		if allocation.Balance <= 0 {
+			return nil, fmt.Errorf("allocation %d: %w", i, ErrInvalidAmount)
+		}
+
+		transaction.ID.HashString(fmt.Sprintf("genesis allocation %d", i))
+		transaction.Hash.Set(transaction.GetHash())
+		result.Transactions = append(result.Transactions, transaction)
+	}
+
+	if len(result.Transactions) > 0 {
+		tree := &MerkleTree{}
+		root, err := tree.BuildMarkleTree(result.Transactions)
+		if err != nil {
+			return nil, err
+		}
+		result.Merkle = root.Hash
+	}
+
+	state := NewLedgerState()
+	_, receipts, err := state.Apply(result)
+	if err != nil {
+		return nil, err
+	}
+	result.StateRoot = NewStateTree(state).Root()
+	result.ReceiptsRoot = ReceiptsRoot(receipts)
+
+	paramsHash, err := t.paramsHash()
+	if err != nil {
+		return nil, err
+	}
+
+	result.Hash = result.genesisHash(&paramsHash)
+
+	if len(t.Hash) > 0 {
+		expected := HashBlock{}
+		if err = expected.SetHexString(t.Hash); err != nil {
+			return nil, err
+		}
+
+		if !expected.Equal(&result.Hash) {
+			return nil, ErrGenesisMismatch
+		}
+	}
+
+	return result, nil
+}
+
+/* The genesis is not mined, its hash commits to the header and to the chain parameters of the network */
+func (b *Block) genesisHash(paramsHash *HashBlock) (result HashBlock) {
+	version := make([]byte, 2)
+	binary.LittleEndian.PutUint16(version, b.Version)
+
+	hash := sha3.New256()
+	hash.Write(b.Parent[:])
+	hash.Write(b.Nonce[:])
+	hash.Write(b.Merkle[:])
+	hash.Write(utils.Uint64ToBytes(b.Difficulty))
+	hash.Write(utils.Uint64ToBytes(b.Time))
+	hash.Write(version)
+	hash.Write(b.Coinbase[:])
+	hash.Write(b.StateRoot[:])
+	if empty := (HashBlock{}); !b.ReceiptsRoot.Equal(&empty) {
+		hash.Write(b.ReceiptsRoot[:])
+	}
+	hash.Write(paramsHash[:])
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* InitGenesis() creates the blockchain database with the genesis block of the template and saves its chain parameters */
+func InitGenesis(fileName string) (result *Block, err error) {
+	template, err := LoadGenesisTemplate(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := template.ChainParams()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = template.Block()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = result.CheckCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	dat := database.BlockDB{}
+	err = dat.Open()
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return nil, err
+	}
+	defer dat.Close()
+
+	if _, err = dat.Last(); !errors.Is(err, database.ErrEmpty) {
+		if matchesCheckpoints(&dat) {
+			return nil, ErrChainInitialized
+		}
+
+		// A chain rejected by the checkpoints cannot be loaded, it is replaced
+		log.Printf("The blocks of %s do not match the checkpoints of the %s network, they are discarded\r\n", database.BlocksFileName, Net().Name)
+		if err = dat.Clear(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range []string{database.StateFileName, database.SideBlocksFileName, database.TransactionsFileName, database.ReceiptsFileName} {
+		if err = clearDatabaseFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(params, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(Net().DataFile(ChainParamsFileName), data, 0664); err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(Net().DataFile(GenesisFileName), data, 0664); err != nil {
+		return nil, err
+	}
+
+	return result, dat.Add(data)
+}
+
+/* matchesCheckpoints() tells whether every stored block agrees with the checkpoints of the network */
+func matchesCheckpoints(dat *database.BlockDB) (result bool) {
+	result = true
+	dat.LoadData(func(data []byte) {
+		block := Block{}
+		if json.Unmarshal(data, &block) == nil && block.CheckCheckpoint() != nil {
+			result = false
+		}
+	})
+
+	return result
+}
+
+func clearDatabaseFile(fileName string) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(fileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	return db.Clear()
+}
@@ -0,0 +1,268 @@
+package blockchain
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"engine/utils"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HDWalletFileName    = "wallet.json"
+	MnemonicEntropyBits = 256 // 24 words
+	HDGapLimit          = 20  // Unused accounts in a row after which restorewallet stops scanning
+
+	hardenedOffset = uint32(0x80000000)
+	hdSeedData     = "hd wallet seed"
+)
+
+/* HD wallet of the keystore. The accounts are derived from the seed with SLIP-0010 for Ed25519 */
+type HDWalletFile struct {
+	Seed      KeystoreFile `json:"seed"`       // BIP-39 seed encrypted with the wallet passphrase
+	NextIndex uint32       `json:"next_index"` // Index of the account derived by the next newaccount
+}
+
+/* HDPath() is the derivation path of the account with the given index */
+func HDPath(index uint32) string {
+	return fmt.Sprintf("m/44'/%d'/%d'", Net().CoinType, index)
+}
+
+/* ParseHDPath() returns the child indexes of a path like m/44'/7411'/0'. Every level must be hardened */
+func ParseHDPath(path string) (result []uint32, err error) {
+	levels := strings.Split(path, "/")
+	if levels[0] != "m" {
+		return nil, ErrInvalidHDPath
+	}
+
+	result = make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		if !strings.HasSuffix(level, "'") && !strings.HasSuffix(level, "H") {
+			return nil, ErrInvalidHDPath
+		}
+
+		index, err := strconv.ParseUint(level[:len(level)-1], 10, 31)
+		if err != nil {
+			return nil, ErrInvalidHDPath
+		}
+
+		result = append(result, uint32(index)+hardenedOffset)
+	}
+
+	return result, nil
+}
+
+/* DeriveHDKey() derives the Ed25519 private key seed and chain code of a path from the wallet seed, as defined by SLIP-0010 */
+func DeriveHDKey(seed []byte, path string) (key []byte, chainCode []byte, err error) {
+	indexes, err := ParseHDPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode = sum[:32], sum[32:]
+
+	for _, index := range indexes {
+		data := make([]byte, 37)
+		copy(data[1:], key)
+		binary.BigEndian.PutUint32(data[33:], index)
+
+		mac = hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum = mac.Sum(nil)
+		key, chainCode = sum[:32], sum[32:]
+	}
+
+	return key, chainCode, nil
+}
+
+func hdWalletFileName() string {
+	return Net().DataFile(KeystoreDirName + "/" + HDWalletFileName)
+}
+
+func HDWalletExists() bool {
+	_, err := os.Stat(hdWalletFileName())
+	return err == nil
+}
+
+func loadHDWallet() (result *HDWalletFile, err error) {
+	data, err := os.ReadFile(hdWalletFileName())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoHDWallet
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result = &HDWalletFile{}
+	err = json.Unmarshal(data, result)
+
+	return result, err
+}
+
+func (w *HDWalletFile) save() error {
+	return writeKeystoreFile(hdWalletFileName(), w)
+}
+
+func (w *HDWalletFile) seed(passphrase string) ([]byte, error) {
+	return w.Seed.open([]byte(hdSeedData), passphrase)
+}
+
+/* CreateHDWallet() creates the HD wallet from a new random mnemonic, which is returned so the user can write it down */
+func CreateHDWallet(passphrase string) (mnemonic string, err error) {
+	if HDWalletExists() {
+		return "", ErrWalletExists
+	}
+
+	mnemonic, err = utils.NewMnemonic(MnemonicEntropyBits)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = saveHDSeed(mnemonic, passphrase); err != nil {
+		return "", err
+	}
+
+	return mnemonic, nil
+}
+
+func saveHDSeed(mnemonic string, passphrase string) (result *HDWalletFile, err error) {
+	seed, err := utils.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := sealKeystoreFile(seed, []byte(hdSeedData), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &HDWalletFile{Seed: *file}
+	return result, result.save()
+}
+
+/* deriveAccount() creates the account of an index of the HD wallet, keeping its private key in the keystore */
+func deriveAccount(seed []byte, index uint32, label string, passphrase string) (result *Account, err error) {
+	if len(label) == 0 || len(label) > 64 {
+		return nil, errors.New("account label has invalid length. Maximum length is 64 characters")
+	}
+
+	key, _, err := DeriveHDKey(seed, HDPath(index))
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, privateKey := ed25519KeyPair(key)
+
+	result = &Account{
+		Address:    AddressFromPublicKey(publicKey),
+		CreateTime: uint64(time.Now().Unix()),
+		PublicKey:  publicKey,
+	}
+	copy(result.Label[:], []byte(label))
+
+	if err = Wallet().Store(&result.Address, privateKey, passphrase); err != nil {
+		return nil, err
+	}
+
+	if existing, err := FindAccount(&result.Address); err == nil {
+		return existing, nil
+	}
+
+	return result, result.Persist()
+}
+
+/* RestoreHDWallet() recreates the HD wallet from its mnemonic and the accounts derived from it that were used in the chain */
+func RestoreHDWallet(mnemonic string, passphrase string) (result []Account, err error) {
+	seed, err := utils.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := loadHDWallet()
+	if errors.Is(err, ErrNoHDWallet) {
+		wallet, err = saveHDSeed(mnemonic, passphrase)
+	} else if err == nil {
+		current, err := wallet.seed(passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hmac.Equal(current, seed) {
+			return nil, ErrWalletExists
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	used := (&Blockchain{}).UsedAddresses()
+
+	restore := uint32(0)
+	for index, unused := uint32(0), 0; unused < HDGapLimit; index++ {
+		key, _, err := DeriveHDKey(seed, HDPath(index))
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, _ := ed25519KeyPair(key)
+		if used[AddressFromPublicKey(publicKey)] {
+			restore = index + 1
+			unused = 0
+		} else {
+			unused++
+		}
+	}
+
+	result = make([]Account, 0, restore)
+	for index := uint32(0); index < restore; index++ {
+		account, err := deriveAccount(seed, index, fmt.Sprintf("restored %d", index), passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *account)
+	}
+
+	if restore > wallet.NextIndex {
+		wallet.NextIndex = restore
+	}
+
+	return result, wallet.save()
+}
+
+/* UsedAddresses() returns the addresses that sent or received coins in the main chain, including the pruned blocks through the ledger state */
+func (b *Blockchain) UsedAddresses() (result map[HashBlock]bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := b.loadState()
+
+	result = make(map[HashBlock]bool)
+	for address := range state.Balances {
+		result[address] = true
+	}
+
+	for address := range state.Nonces {
+		result[address] = true
+	}
+
+	for _, block := range b.Blocks {
+		for _, transaction := range block.Transactions {
+			if !transaction.IsCoinbase() {
+				result[transaction.From] = true
+			}
+			result[transaction.To] = true
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,320 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"engine/utils"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	MaxPreimageSize = 256
+
+	HTLCClaim  = byte(0x01) // Witness of the recipient revealing the preimage before the deadline
+	HTLCRefund = byte(0x02) // Witness of the sender taking the funds back after the deadline
+)
+
+type (
+	/* Hash time-locked contract. Its address is the hash of its terms, the coins sent to it are locked by them */
+	HTLC struct {
+		Sender    HashBlock // Account refunded after the deadline
+		Recipient HashBlock // Account that claims the funds revealing the preimage
+		HashLock  HashBlock // SHA3-256 hash of the preimage
+		Deadline  uint64    // Block height, or Unix time when >= LockTimeThreshold, when the claim expires and the refund opens
+	}
+
+	/* Signature of a transfer from a contract: the claim or refund mode, the preimage of a claim and the signature of the sender or recipient */
+	HTLCWitness struct {
+		Mode      byte
+		Preimage  []byte
+		PublicKey []byte
+		Signature []byte
+	}
+)
+
+func NewHTLC(sender HashBlock, recipient HashBlock, hashLock HashBlock, deadline uint64) (*HTLC, error) {
+	if deadline == 0 || sender.Equal(&recipient) {
+		return nil, ErrInvalidHTLC
+	}
+
+	return &HTLC{Sender: sender, Recipient: recipient, HashLock: hashLock, Deadline: deadline}, nil
+}
+
+/* NewPreimage() creates a random secret for a contract and returns it with its hash lock */
+func NewPreimage() (preimage []byte, hashLock HashBlock, err error) {
+	preimage = make([]byte, 32)
+	if _, err = rand.Read(preimage); err != nil {
+		return nil, hashLock, err
+	}
+
+	return preimage, sha3.Sum256(preimage), nil
+}
+
+/* Bytes() serializes the terms: the key type, the sender, the recipient, the hash lock and the deadline */
+func (h *HTLC) Bytes() []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteByte(byte(KeyTypeHTLC))
+	buff.Write(h.Sender[:])
+	buff.Write(h.Recipient[:])
+	buff.Write(h.HashLock[:])
+	binary.Write(buff, binary.LittleEndian, h.Deadline)
+
+	return buff.Bytes()
+}
+
+func ParseHTLC(data []byte) (result *HTLC, err error) {
+	keyType, raw, err := splitKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyType != KeyTypeHTLC || len(raw) != 3*len(HashBlock{})+8 {
+		return nil, ErrInvalidHTLC
+	}
+
+	result = &HTLC{}
+	buff := bytes.NewReader(raw)
+	buff.Read(result.Sender[:])
+	buff.Read(result.Recipient[:])
+	buff.Read(result.HashLock[:])
+	binary.Read(buff, binary.LittleEndian, &result.Deadline)
+
+	return NewHTLC(result.Sender, result.Recipient, result.HashLock, result.Deadline)
+}
+
+func (h *HTLC) Address() HashBlock {
+	return AddressFromPublicKey(h.Bytes())
+}
+
+/* Expired() tells whether the deadline is reached for a block with the given height and time */
+func (h *HTLC) Expired(height uint64, blockTime uint64) bool {
+	return lockTimeReached(h.Deadline, height, blockTime)
+}
+
+/* Bytes() serializes the witness: the key type, the mode and the preimage, public key and signature prefixed by their length */
+func (w *HTLCWitness) Bytes() []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteByte(byte(KeyTypeHTLC))
+	buff.WriteByte(w.Mode)
+
+	for _, field := range [][]byte{w.Preimage, w.PublicKey, w.Signature} {
+		binary.Write(buff, binary.LittleEndian, uint16(len(field)))
+		buff.Write(field)
+	}
+
+	return buff.Bytes()
+}
+
+func ParseHTLCWitness(data []byte) (result *HTLCWitness, err error) {
+	keyType, raw, err := splitKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyType != KeyTypeHTLC || len(raw) < 1 || (raw[0] != HTLCClaim && raw[0] != HTLCRefund) {
+		return nil, ErrInvalidSignature
+	}
+
+	result = &HTLCWitness{Mode: raw[0]}
+	buff := bytes.NewReader(raw[1:])
+
+	for _, field := range []*[]byte{&result.Preimage, &result.PublicKey, &result.Signature} {
+		size := uint16(0)
+		if err = binary.Read(buff, binary.LittleEndian, &size); err != nil {
+			return nil, ErrInvalidSignature
+		}
+
+		*field = make([]byte, size)
+		if _, err = io.ReadFull(buff, *field); err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	if buff.Len() > 0 || len(result.Preimage) > MaxPreimageSize || (result.Mode == HTLCRefund && len(result.Preimage) > 0) {
+		return nil, ErrInvalidSignature
+	}
+
+	return result, nil
+}
+
+/* Verify() checks a claim reveals the preimage and is signed by the recipient, or a refund is signed by the sender */
+func (h *HTLC) Verify(signedData []byte, signature []byte) error {
+	witness, err := ParseHTLCWitness(signature)
+	if err != nil {
+		return err
+	}
+
+	signer := h.Sender
+	if witness.Mode == HTLCClaim {
+		signer = h.Recipient
+
+		hashLock := HashBlock(sha3.Sum256(witness.Preimage))
+		if !hashLock.Equal(&h.HashLock) {
+			return ErrInvalidPreimage
+		}
+	}
+
+	keyType, _, err := splitKey(witness.PublicKey)
+	if err != nil || (keyType != KeyTypeRSA && keyType != KeyTypeEd25519) {
+		return ErrInvalidPublicKey
+	}
+
+	address := AddressFromPublicKey(witness.PublicKey)
+	if !address.Equal(&signer) {
+		return ErrInvalidPublicKey
+	}
+
+	return verifySignature(witness.PublicKey, signedData, witness.Signature)
+}
+
+/* CheckHTLC() applies the deadline of the contract the transaction spends from: claims before it, refunds from it on */
+func (t *Transaction) CheckHTLC(height uint64, blockTime uint64) error {
+	if len(t.PublicKey) == 0 || KeyType(t.PublicKey[0]) != KeyTypeHTLC {
+		return nil
+	}
+
+	contract, err := ParseHTLC(t.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	witness, err := ParseHTLCWitness(t.Signature)
+	if err != nil {
+		return err
+	}
+
+	expired := contract.Expired(height, blockTime)
+	if witness.Mode == HTLCClaim && expired {
+		return ErrHTLCExpired
+	}
+
+	if witness.Mode == HTLCRefund && !expired {
+		return ErrHTLCNotExpired
+	}
+
+	return nil
+}
+
+/* LockHTLC() sends coins from a local account, which must be unlocked, to the contract */
+func LockHTLC(bc *Blockchain, contract *HTLC, ammount Amount, fee Amount) (result *Transaction, err error) {
+	address := contract.Address()
+	return bc.NewTransaction(EncodeAddress(&contract.Sender), EncodeAddress(&address), ammount, fee, 0)
+}
+
+/* witnessSize() is the size of a witness of the given mode signed with a key of the given type */
+func (h *HTLC) witnessSize(mode byte, preimageSize int, keyType KeyType) int {
+	publicKeySize, signatureSize := keyType.KeySizes()
+	if mode == HTLCRefund {
+		preimageSize = 0
+	}
+
+	return 8 + preimageSize + publicKeySize + signatureSize
+}
+
+/* EstimateHTLCFee() suggests the fee of a claim or refund of the contract signed with a key of the given type */
+func (b *Blockchain) EstimateHTLCFee(contract *HTLC, mode byte, preimageSize int, keyType KeyType) Amount {
+	return b.estimateFee(len(contract.Bytes()), contract.witnessSize(mode, preimageSize, keyType), 0, 0)
+}
+
+/* ClaimHTLC() transfers the coins of the contract to the recipient, a local account that must be unlocked, revealing the preimage */
+func ClaimHTLC(bc *Blockchain, contract *HTLC, preimage []byte) (*Transaction, error) {
+	if len(preimage) > MaxPreimageSize {
+		return nil, ErrInvalidPreimage
+	}
+
+	if hashLock := HashBlock(sha3.Sum256(preimage)); !hashLock.Equal(&contract.HashLock) {
+		return nil, ErrInvalidPreimage
+	}
+
+	return spendHTLC(bc, contract, &HTLCWitness{Mode: HTLCClaim, Preimage: preimage})
+}
+
+/* RefundHTLC() transfers the coins of the contract back to the sender, a local account that must be unlocked. The mempool holds it until the deadline */
+func RefundHTLC(bc *Blockchain, contract *HTLC) (*Transaction, error) {
+	return spendHTLC(bc, contract, &HTLCWitness{Mode: HTLCRefund})
+}
+
+func spendHTLC(bc *Blockchain, contract *HTLC, witness *HTLCWitness) (result *Transaction, err error) {
+	signer, to, lockTime := contract.Recipient, contract.Recipient, uint64(0)
+	if witness.Mode == HTLCRefund {
+		signer, to, lockTime = contract.Sender, contract.Sender, contract.Deadline
+	}
+
+	account, err := FindAccount(&signer)
+	if err != nil {
+		return nil, err
+	}
+
+	address := contract.Address()
+	mempool := &Mempool{}
+
+	// Spends of the contract that cannot be included in the next block, a claim past the deadline or a refund before it, give their nonce to this one
+	stale := make([]Transaction, 0)
+	for _, pending := range mempool.Pending() {
+		if pending.From.Equal(&address) && pending.CheckHTLC(bc.CurrentBlock().Id+1, uint64(time.Now().Unix())) != nil {
+			stale = append(stale, pending)
+		}
+	}
+	if err = mempool.Remove(stale); err != nil {
+		return nil, err
+	}
+
+	fee := bc.EstimateHTLCFee(contract, witness.Mode, len(witness.Preimage), account.KeyType())
+	ammount, err := bc.Balance(&address).Sub(fee)
+	if err != nil || ammount <= 0 {
+		return nil, ErrHTLCEmpty
+	}
+
+	result = &Transaction{
+		ID:         utils.NewRandomHash(),
+		From:       address,
+		To:         to,
+		CreateTime: uint64(time.Now().Unix()),
+		Ammount:    ammount,
+		Fee:        fee,
+		LockTime:   lockTime,
+		PublicKey:  contract.Bytes(),
+	}
+	result.Nonce = mempool.NextNonce(&address, bc.AccountNonce(&address))
+	result.Hash.Set(result.GetHash())
+
+	witness.PublicKey = account.PublicKey
+	witness.Signature, err = Wallet().Sign(&signer, result.Hash[:])
+	if err != nil {
+		return nil, err
+	}
+	result.Signature = witness.Bytes()
+
+	return result, mempool.Add(result, bc.AccountNonce)
+}
+
+/* RevealedPreimage() returns the preimage of the claim of the contract included in the main chain, or nil when it was not claimed. Scanning back to a pruned block returns ErrBlockPruned, the claim may be in it */
+func (b *Blockchain) RevealedPreimage(contract *HTLC) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+
+	address := contract.Address()
+	for i := len(b.Blocks) - 1; i >= 0; i-- {
+		if b.Blocks[i].Pruned {
+			return nil, ErrBlockPruned
+		}
+
+		for _, transaction := range b.Blocks[i].Transactions {
+			if !transaction.From.Equal(&address) {
+				continue
+			}
+
+			if witness, err := ParseHTLCWitness(transaction.Signature); err == nil && witness.Mode == HTLCClaim {
+				return witness.Preimage, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
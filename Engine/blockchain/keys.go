@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"engine/utils"
+
+	"golang.org/x/crypto/sha3"
+)
+
+/* Keys and signatures are serialized as one key type byte followed by the key or the signature */
+type KeyType byte
+
+const (
+	KeyTypeRSA      KeyType = 0x01 // PKCS #1 RSA keys of the first accounts. Still read, so old accounts keep working
+	KeyTypeEd25519  KeyType = 0x02
+	KeyTypeMultisig KeyType = 0x03 // Threshold and public keys of a multisig account. Its signatures hold the signatures of the signers
+	KeyTypeHTLC     KeyType = 0x04 // Terms of a hash time-locked contract. Its signatures are the claim or refund witnesses
+
+	DefaultKeyType = KeyTypeEd25519
+	RSAKeyBits     = 2048
+)
+
+func (k KeyType) String() string {
+	switch k {
+	case KeyTypeRSA:
+		return "rsa"
+	case KeyTypeEd25519:
+		return "ed25519"
+	case KeyTypeMultisig:
+		return "multisig"
+	case KeyTypeHTLC:
+		return "htlc"
+	}
+
+	return "unknown"
+}
+
+/* KeySizes() returns the serialized size of the public key and of the signatures of a key type */
+func (k KeyType) KeySizes() (publicKey int, signature int) {
+	switch k {
+	case KeyTypeRSA:
+		return 1 + 270, 1 + RSAKeyBits/8
+	case KeyTypeEd25519:
+		return 1 + ed25519.PublicKeySize, 1 + ed25519.SignatureSize
+	}
+
+	return 0, 0
+}
+
+/* GenerateKeyPair() creates a new serialized key pair. Ed25519 private keys are kept as their 32 bytes seed */
+func GenerateKeyPair(keyType KeyType) (publicKey []byte, privateKey []byte, err error) {
+	switch keyType {
+	case KeyTypeRSA:
+		publicKey, privateKey = utils.GenerateRSAKeyPair(RSAKeyBits)
+		if publicKey == nil {
+			return nil, nil, ErrUnknownKeyType
+		}
+	case KeyTypeEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKey, privateKey = public, private.Seed()
+	default:
+		return nil, nil, ErrUnknownKeyType
+	}
+
+	return tagKey(keyType, publicKey), tagKey(keyType, privateKey), nil
+}
+
+/* ed25519KeyPair() returns the serialized key pair of an Ed25519 private key seed, like the keys derived by the HD wallet */
+func ed25519KeyPair(seed []byte) (publicKey []byte, privateKey []byte) {
+	public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	return tagKey(KeyTypeEd25519, public), tagKey(KeyTypeEd25519, seed)
+}
+
+func tagKey(keyType KeyType, data []byte) []byte {
+	return append([]byte{byte(keyType)}, data...)
+}
+
+/* splitKey() returns the type and the raw bytes of a serialized key or signature */
+func splitKey(data []byte) (keyType KeyType, raw []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, ErrUnknownKeyType
+	}
+
+	keyType = KeyType(data[0])
+	if keyType < KeyTypeRSA || keyType > KeyTypeHTLC {
+		return 0, nil, ErrUnknownKeyType
+	}
+
+	return keyType, data[1:], nil
+}
+
+func signData(privateKey []byte, data []byte) (result []byte, err error) {
+	keyType, raw, err := splitKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch keyType {
+	case KeyTypeRSA:
+		key, err := x509.ParsePKCS1PrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := sha3.New256()
+		hash.Write(data)
+
+		result, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+	case KeyTypeEd25519:
+		if len(raw) != ed25519.SeedSize {
+			return nil, ErrUnknownKeyType
+		}
+
+		result = ed25519.Sign(ed25519.NewKeyFromSeed(raw), data)
+	default:
+		return nil, ErrUnknownKeyType
+	}
+
+	return tagKey(keyType, result), nil
+}
+
+/* verifySignature() accepts a single encoding of a signature, so nobody but the signer can change the bytes of a transaction without changing its hash */
+func verifySignature(publicKey []byte, signedData []byte, signature []byte) (err error) {
+	keyType, raw, err := splitKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	signatureType, rawSignature, err := splitKey(signature)
+	if err != nil {
+		return err
+	}
+
+	if signatureType != keyType {
+		return ErrInvalidSignature
+	}
+
+	switch keyType {
+	case KeyTypeRSA:
+		key, err := x509.ParsePKCS1PublicKey(raw)
+		if err != nil {
+			return err
+		}
+
+		if len(rawSignature) != key.Size() {
+			return ErrInvalidSignature
+		}
+
+		hash := sha3.New256()
+		hash.Write(signedData)
+
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash.Sum(nil), rawSignature)
+	case KeyTypeEd25519:
+		// Verify() also rejects the non-canonical encodings of the scalar of the signature
+		if len(raw) != ed25519.PublicKeySize || len(rawSignature) != ed25519.SignatureSize ||
+			!ed25519.Verify(ed25519.PublicKey(raw), signedData, rawSignature) {
+			return ErrInvalidSignature
+		}
+	case KeyTypeMultisig:
+		key, err := ParseMultisigKey(publicKey)
+		if err != nil {
+			return err
+		}
+
+		return key.Verify(signedData, signature)
+	case KeyTypeHTLC:
+		contract, err := ParseHTLC(publicKey)
+		if err != nil {
+			return err
+		}
+
+		return contract.Verify(signedData, signature)
+	}
+
+	return nil
+}
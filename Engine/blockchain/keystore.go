@@ -0,0 +1,310 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KeystoreDirName      = "keystore"
+	DefaultUnlockTimeout = 5 * time.Minute
+
+	keystoreKDF    = "scrypt"
+	keystoreCipher = "aes-256-gcm"
+	scryptN        = 1 << 16
+	scryptR        = 8
+	scryptP        = 1
+	scryptKeyLen   = 32
+)
+
+type (
+	KeystoreKDFParams struct {
+		N    int    `json:"n"`
+		R    int    `json:"r"`
+		P    int    `json:"p"`
+		Salt string `json:"salt"`
+	}
+
+	/* Private key of an account encrypted with a key derived from its passphrase, one file per account */
+	KeystoreFile struct {
+		Address    string            `json:"address,omitempty"`
+		KDF        string            `json:"kdf"`
+		KDFParams  KeystoreKDFParams `json:"kdf_params"`
+		Cipher     string            `json:"cipher"`
+		Nonce      string            `json:"nonce"`
+		Ciphertext string            `json:"ciphertext"`
+	}
+
+	unlockedKey struct {
+		privateKey []byte
+		expires    time.Time
+		timer      *time.Timer
+	}
+
+	/* Keystore keeps the decrypted private keys of the unlocked accounts until they are locked again */
+	Keystore struct {
+		mutex    sync.Mutex
+		unlocked map[HashBlock]*unlockedKey
+	}
+)
+
+var wallet = &Keystore{unlocked: make(map[HashBlock]*unlockedKey)}
+
+/* Wallet() is the keystore of the accounts of this node */
+func Wallet() *Keystore {
+	return wallet
+}
+
+func keystoreFileName(address *HashBlock) string {
+	return path.Join(Net().DataFile(KeystoreDirName), EncodeAddress(address)+".json")
+}
+
+/* Store() encrypts the private key of the account with the passphrase and saves it in the keystore directory */
+func (k *Keystore) Store(address *HashBlock, privateKey []byte, passphrase string) (err error) {
+	file, err := sealKeystoreFile(privateKey, address[:], passphrase)
+	if err != nil {
+		return err
+	}
+	file.Address = EncodeAddress(address)
+
+	return writeKeystoreFile(keystoreFileName(address), file)
+}
+
+/* sealKeystoreFile() encrypts the secret with a key derived from the passphrase, authenticating it with the additional data */
+func sealKeystoreFile(secret []byte, additionalData []byte, passphrase string) (file *KeystoreFile, err error) {
+	file = &KeystoreFile{
+		KDF:    keystoreKDF,
+		Cipher: keystoreCipher,
+		KDFParams: KeystoreKDFParams{
+			N: scryptN,
+			R: scryptR,
+			P: scryptP,
+		},
+	}
+
+	salt := make([]byte, 32)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	file.KDFParams.Salt = hex.EncodeToString(salt)
+
+	gcm, err := file.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	file.Nonce = hex.EncodeToString(nonce)
+	file.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, secret, additionalData))
+
+	return file, nil
+}
+
+func writeKeystoreFile(fileName string, file interface{}) error {
+	data, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(Net().DataFile(KeystoreDirName), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, data, 0600)
+}
+
+/* HasKey() tells whether the keystore has the private key of the account */
+func (k *Keystore) HasKey(address *HashBlock) bool {
+	_, err := os.Stat(keystoreFileName(address))
+	return err == nil
+}
+
+/* Unlock() decrypts the private key of the account and keeps it in memory until the timeout, or DefaultUnlockTimeout when zero */
+func (k *Keystore) Unlock(address *HashBlock, passphrase string, timeout time.Duration) (err error) {
+	privateKey, err := k.decrypt(address, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultUnlockTimeout
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.lock(address)
+
+	locked := *address
+	key := &unlockedKey{
+		privateKey: privateKey,
+		expires:    time.Now().Add(timeout),
+	}
+	k.unlocked[locked] = key
+
+	// A timer that fired while this unlock waited for the mutex must not lock it, so it only locks its own unlock
+	key.timer = time.AfterFunc(timeout, func() {
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+
+		if k.unlocked[locked] != key {
+			return
+		}
+
+		k.lock(&locked)
+		log.Printf("Account %s locked after the unlock timeout\r\n", EncodeAddress(&locked))
+	})
+
+	return nil
+}
+
+/* Lock() wipes the decrypted private key of the account from memory */
+func (k *Keystore) Lock(address *HashBlock) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.lock(address)
+}
+
+func (k *Keystore) LockAll() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for address := range k.unlocked {
+		k.lock(&address)
+	}
+}
+
+/* lock() needs the mutex locked */
+func (k *Keystore) lock(address *HashBlock) {
+	key, ok := k.unlocked[*address]
+	if !ok {
+		return
+	}
+
+	key.timer.Stop()
+	for i := range key.privateKey {
+		key.privateKey[i] = 0
+	}
+	delete(k.unlocked, *address)
+}
+
+/* UnlockedUntil() returns when the account will be locked again, or false when it is locked */
+func (k *Keystore) UnlockedUntil(address *HashBlock) (time.Time, bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, ok := k.unlocked[*address]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return key.expires, true
+}
+
+/* Sign() signs the data with the private key of an unlocked account */
+func (k *Keystore) Sign(address *HashBlock, data []byte) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, ok := k.unlocked[*address]
+	if !ok {
+		return nil, ErrWalletLocked
+	}
+
+	return signData(key.privateKey, data)
+}
+
+/* ChangePassphrase() encrypts the private key of the account again with a new passphrase */
+func (k *Keystore) ChangePassphrase(address *HashBlock, passphrase string, newPassphrase string) error {
+	privateKey, err := k.decrypt(address, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return k.Store(address, privateKey, newPassphrase)
+}
+
+func (k *Keystore) decrypt(address *HashBlock, passphrase string) (result []byte, err error) {
+	data, err := os.ReadFile(keystoreFileName(address))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := &KeystoreFile{}
+	if err = json.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+
+	return file.open(address[:], passphrase)
+}
+
+/* open() decrypts the secret of the file */
+func (f *KeystoreFile) open(additionalData []byte, passphrase string) (result []byte, err error) {
+	if f.KDF != keystoreKDF || f.Cipher != keystoreCipher {
+		return nil, ErrKeystoreFormat
+	}
+
+	gcm, err := f.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(f.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := hex.DecodeString(f.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrKeystoreFormat
+	}
+
+	result, err = gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return result, nil
+}
+
+/* cipher() derives the encryption key from the passphrase with the KDF parameters of the file */
+func (f *KeystoreFile) cipher(passphrase string) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(f.KDFParams.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, f.KDFParams.N, f.KDFParams.R, f.KDFParams.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
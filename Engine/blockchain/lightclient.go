@@ -0,0 +1,361 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/database"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const LightClientTimeout = 30 * time.Second
+
+type (
+	/* Asks a full node for the inclusion proof of a transaction. Without a block id the node finds it through the receipts */
+	PaymentProofRequest struct {
+		Transaction HashBlock `json:"transaction"` // ID or hash of the transaction
+		BlockId     *uint64   `json:"block_id,omitempty"`
+	}
+
+	/* A transaction with the proof of its inclusion in a block, checked by a light client against its headers */
+	PaymentProof struct {
+		Transaction Transaction `json:"transaction"`
+		Proof       MerkleProof `json:"proof"`
+	}
+
+	/* Light client keeping only the block headers, validated by their proof of work and linkage */
+	LightClient struct {
+		mutex   sync.Mutex
+		headers []Block
+	}
+)
+
+/* Headers() returns up to count headers of the main chain starting at the block "from" */
+func (b *Blockchain) Headers(from uint64, count int) (result []Block) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+
+	if count <= 0 || count > MaxHeadersPerPack {
+		count = MaxHeadersPerPack
+	}
+
+	result = make([]Block, 0, count)
+	for i := from; i < uint64(len(b.Blocks)) && len(result) < count; i++ {
+		result = append(result, b.Blocks[i].Header())
+	}
+
+	return result
+}
+
+/* PaymentProof() finds the transaction in the main chain and proves its inclusion in the block */
+func (b *Blockchain) PaymentProof(request *PaymentProofRequest) (result *PaymentProof, err error) {
+	var blockId uint64
+	if request.BlockId != nil {
+		blockId = *request.BlockId
+	} else {
+		receipt, err := b.Receipt(&request.Transaction)
+		if err != nil {
+			return nil, err
+		}
+		blockId = receipt.BlockId
+	}
+
+	block, err := b.GetBlock(blockId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transaction := range block.Transactions {
+		if !transaction.ID.Equal(&request.Transaction) && !transaction.Hash.Equal(&request.Transaction) {
+			continue
+		}
+
+		proof, err := block.MerkleProof(&transaction.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PaymentProof{Transaction: transaction, Proof: *proof}, nil
+	}
+
+	return nil, ErrTransactionNotFound
+}
+
+/* OpenLightClient() loads the headers-only store. A new store starts with the genesis built from the template of the network */
+func OpenLightClient() (result *LightClient, err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.HeadersFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return nil, err
+	}
+	defer db.Close()
+
+	result = &LightClient{headers: make([]Block, 0)}
+	db.ForEach(func(data []byte) {
+		header := Block{}
+		if json.Unmarshal(data, &header) == nil {
+			result.headers = append(result.headers, header)
+		}
+	})
+
+	if len(result.headers) > 0 {
+		return result, nil
+	}
+
+	template, err := LoadGenesisTemplate(Net().DataFile(GenesisTemplateFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	genesis, err := template.Block()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = genesis.CheckCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	header := genesis.Header()
+	data, err := json.Marshal(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	result.headers = append(result.headers, header)
+
+	return result, db.Write(data)
+}
+
+/* Tip() is the last header of the chain with the most work known by the light client */
+func (c *LightClient) Tip() Block {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.headers[len(c.headers)-1]
+}
+
+func (c *LightClient) Header(id uint64) (result *Block, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id >= uint64(len(c.headers)) {
+		return nil, ErrHeaderNotFound
+	}
+
+	header := c.headers[id]
+	return &header, nil
+}
+
+/* AddHeaders() validates consecutive headers and stores them, switching branch when they fork with more work. Returns how many were new */
+func (c *LightClient) AddHeaders(headers []Block) (result int, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for len(headers) > 0 && headers[0].Id < uint64(len(c.headers)) && c.headers[headers[0].Id].Hash.Equal(&headers[0].Hash) {
+		headers = headers[1:]
+	}
+
+	if len(headers) == 0 {
+		return 0, nil
+	}
+
+	fork := headers[0].Id
+	if fork == 0 || fork > uint64(len(c.headers)) {
+		return 0, ErrInvalidParent
+	}
+
+	if uint64(len(c.headers))-fork > Params().MaxReorgDepth {
+		return 0, ErrReorgTooDeep
+	}
+
+	if last, ok := LastCheckpoint(uint64(len(c.headers))); ok && fork <= last {
+		return 0, ErrBelowCheckpoint
+	}
+
+	branch := append(make([]Block, 0, int(fork)+len(headers)), c.headers[:fork]...)
+	for i := range headers {
+		header := headers[i].Header()
+		if err = header.CheckProofOfWork(&branch[len(branch)-1]); err != nil {
+			return 0, err
+		}
+
+		if err = header.CheckCheckpoint(); err != nil {
+			return 0, err
+		}
+
+		times := make([]uint64, 0, Params().MedianTimeBlocks)
+		for j := len(branch) - 1; j >= 0 && len(times) < Params().MedianTimeBlocks; j-- {
+			times = append(times, branch[j].Time)
+		}
+
+		if err = header.CheckTimestamp(medianTime(times), AdjustedTime()); err != nil {
+			return 0, err
+		}
+
+		branch = append(branch, header)
+	}
+
+	if fork < uint64(len(c.headers)) && branchWork(branch[fork:]).Cmp(branchWork(c.headers[fork:])) <= 0 {
+		return 0, nil
+	}
+
+	if err = c.save(fork, branch[fork:]); err != nil {
+		return 0, err
+	}
+	c.headers = branch
+
+	return len(headers), nil
+}
+
+func branchWork(headers []Block) *big.Int {
+	result := new(big.Int)
+	for i := range headers {
+		result.Add(result, headers[i].Work())
+	}
+
+	return result
+}
+
+/* save() replaces the stored headers from the id "fork" on. Needs the mutex locked */
+func (c *LightClient) save(fork uint64, headers []Block) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.HeadersFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	for i := uint64(len(c.headers)); i > fork; i-- {
+		if err = db.DeleteLast(); err != nil {
+			return err
+		}
+	}
+
+	for i := range headers {
+		data, err := json.Marshal(&headers[i])
+		if err != nil {
+			return err
+		}
+
+		if err = db.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* Sync() downloads the headers the full node at peer ("host:port") has after the tip, stepping back when its chain forked */
+func (c *LightClient) Sync(peer string) (result int, err error) {
+	conn, err := net.DialTimeout("tcp4", peer, LightClientTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	buffer := ""
+	back := uint64(0)
+
+	for {
+		tip := c.Tip().Id
+		if back > tip {
+			back = tip
+		}
+
+		data, err := request(conn, &buffer, CMD_GETHEADERS, &HeadersRequest{From: tip + 1 - back, Count: MaxHeadersPerPack}, CMD_HEADERS)
+		if err != nil {
+			return result, err
+		}
+
+		headers := make([]Block, 0)
+		if err = json.Unmarshal(data, &headers); err != nil {
+			return result, err
+		}
+
+		if len(headers) == 0 {
+			return result, nil
+		}
+
+		added, err := c.AddHeaders(headers)
+		if errors.Is(err, ErrInvalidParent) && back < Params().MaxReorgDepth && back < tip {
+			back = 2*back + 1
+			continue
+		}
+
+		if err != nil || added == 0 {
+			return result, err
+		}
+
+		result += added
+		back = 0
+	}
+}
+
+/* FetchPaymentProof() asks the full node at peer for the inclusion proof of a transaction */
+func (c *LightClient) FetchPaymentProof(peer string, proofRequest *PaymentProofRequest) (result *PaymentProof, err error) {
+	conn, err := net.DialTimeout("tcp4", peer, LightClientTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buffer := ""
+	data, err := request(conn, &buffer, CMD_GETPROOF, proofRequest, CMD_PROOF)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &PaymentProof{}
+	return result, json.Unmarshal(data, result)
+}
+
+/* VerifyPayment() checks the proof against the stored header of its block and returns the number of confirmations */
+func (c *LightClient) VerifyPayment(proof *PaymentProof) (confirmations uint64, err error) {
+	if hash := proof.Transaction.GetHash(); !hash.Equal(&proof.Proof.TxHash) || !hash.Equal(&proof.Transaction.Hash) {
+		return 0, ErrProofMismatch
+	}
+
+	header, err := c.Header(proof.Proof.BlockId)
+	if err != nil {
+		return 0, err
+	}
+
+	if !proof.Proof.Verify(&header.Merkle) {
+		return 0, ErrInvalidMerkleProof
+	}
+
+	return c.Tip().Id - header.Id + 1, nil
+}
+
+/* request() sends a command to a full node and waits for the pack of the expected answer */
+func request(conn net.Conn, buffer *string, cmd uint8, message interface{}, expect uint8) (result []byte, err error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(LightClientTimeout))
+	if err = sendPack(conn, cmd, data, 0, ""); err != nil {
+		return nil, err
+	}
+
+	for {
+		pack, err := readPack(conn, buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		if pack.Command == CMD_ERROR {
+			return nil, errors.New(pack.ErrorMsg)
+		}
+
+		if pack.Command == expect {
+			return pack.Data, nil
+		}
+	}
+}
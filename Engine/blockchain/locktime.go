@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"strconv"
+	"time"
+)
+
+/* Lock times below the threshold are block heights, the other ones are Unix times */
+const LockTimeThreshold = 500000000
+
+/* IsFinal() tells whether the transaction can be included in a block with the given height and time */
+func (t *Transaction) IsFinal(height uint64, blockTime uint64) bool {
+	return lockTimeReached(t.LockTime, height, blockTime)
+}
+
+func lockTimeReached(lockTime uint64, height uint64, blockTime uint64) bool {
+	if lockTime == 0 {
+		return true
+	}
+
+	if lockTime < LockTimeThreshold {
+		return height >= lockTime
+	}
+
+	return blockTime >= lockTime
+}
+
+/* ParseLockTime() reads a block height, a Unix time or an RFC3339 date, like 1500, 1767225600 or 2026-01-01T00:00:00Z */
+func ParseLockTime(value string) (uint64, error) {
+	if lockTime, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return lockTime, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+
+	if date.Unix() < LockTimeThreshold {
+		return 0, ErrInvalidLockTime
+	}
+
+	return uint64(date.Unix()), nil
+}
@@ -0,0 +1,237 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/database"
+	"errors"
+)
+
+/* Mempool keeps the transactions waiting to be included in a block */
+type Mempool struct {
+}
+
+/* Add() queues a transaction after checking it against the nonces of the chain given by accountNonce */
+func (m *Mempool) Add(transaction *Transaction, accountNonce func(*HashBlock) uint64) (err error) {
+	if err = transaction.VerifySignature(); err != nil {
+		return err
+	}
+
+	if err = transaction.CheckContract(); err != nil {
+		return err
+	}
+
+	if transaction.FeeRate() < Params().MinRelayFeeRate {
+		return ErrFeeTooLow
+	}
+
+	if transaction.Nonce < accountNonce(&transaction.From) {
+		return ErrNonceUsed
+	}
+
+	for _, pending := range m.Pending() {
+		if pending.From.Equal(&transaction.From) && pending.Nonce == transaction.Nonce {
+			return ErrDuplicateNonce
+		}
+	}
+
+	db := &database.DatabaseFile{}
+	err = db.Open(database.TransactionsFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		return err
+	}
+
+	return db.Write(data)
+}
+
+func (m *Mempool) Pending() (result []Transaction) {
+	db := &database.DatabaseFile{}
+	err := db.Open(database.TransactionsFileName)
+	defer db.Close()
+
+	result = make([]Transaction, 0)
+	if err != nil {
+		return result
+	}
+
+	db.ForEach(func(data []byte) {
+		transaction := Transaction{}
+		if json.Unmarshal(data, &transaction) == nil {
+			result = append(result, transaction)
+		}
+	})
+
+	return result
+}
+
+/* Remove() drops the transactions included in a block and the ones spending the same nonces */
+func (m *Mempool) Remove(transactions []Transaction) (err error) {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	remaining := make([]Transaction, 0)
+
+	for _, pending := range m.Pending() {
+		included := false
+		for _, transaction := range transactions {
+			if pending.From.Equal(&transaction.From) && pending.Nonce == transaction.Nonce {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			remaining = append(remaining, pending)
+		}
+	}
+
+	return m.save(remaining)
+}
+
+/* Prune() drops the transactions that can never be included: nonces already used in the chain, invalid signatures and invalid contracts */
+func (m *Mempool) Prune(accountNonce func(*HashBlock) uint64) (err error) {
+	pending := m.Pending()
+	remaining := make([]Transaction, 0, len(pending))
+	nonces := make(map[HashBlock]uint64)
+
+	for i := range pending {
+		transaction := &pending[i]
+
+		nonce, ok := nonces[transaction.From]
+		if !ok {
+			nonce = accountNonce(&transaction.From)
+			nonces[transaction.From] = nonce
+		}
+
+		if transaction.Nonce < nonce || transaction.VerifySignature() != nil || transaction.CheckContract() != nil {
+			continue
+		}
+
+		remaining = append(remaining, *transaction)
+	}
+
+	if len(remaining) == len(pending) {
+		return nil
+	}
+
+	return m.save(remaining)
+}
+
+/* save() replaces the pending transactions */
+func (m *Mempool) save(transactions []Transaction) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.TransactionsFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Clear()
+	if err != nil {
+		return err
+	}
+
+	for i := range transactions {
+		data, _ := json.Marshal(&transactions[i])
+		db.Write(data)
+	}
+
+	return err
+}
+
+/* Restore() puts back the transactions of disconnected blocks, except the coinbase and the nonces already pending */
+func (m *Mempool) Restore(transactions []Transaction) (err error) {
+	pending := m.Pending()
+
+	db := &database.DatabaseFile{}
+	err = db.Open(database.TransactionsFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	for i := range transactions {
+		transaction := &transactions[i]
+		if transaction.IsCoinbase() {
+			continue
+		}
+
+		duplicate := false
+		for _, queued := range pending {
+			if queued.From.Equal(&transaction.From) && queued.Nonce == transaction.Nonce {
+				duplicate = true
+				break
+			}
+		}
+
+		if duplicate {
+			continue
+		}
+
+		data, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+
+		if err = db.Write(data); err != nil {
+			return err
+		}
+		pending = append(pending, *transaction)
+	}
+
+	return nil
+}
+
+/* NextNonce() returns the nonce following the ones already used or queued by the account */
+func (m *Mempool) NextNonce(address *HashBlock, accountNonce uint64) (result uint64) {
+	used := make(map[uint64]bool)
+
+	for _, pending := range m.Pending() {
+		if pending.From.Equal(address) {
+			used[pending.Nonce] = true
+		}
+	}
+
+	for result = accountNonce; used[result]; result++ {
+	}
+
+	return result
+}
+
+/* Ready() groups the pending transactions by sender in nonce order. Transactions after a nonce gap stay queued */
+func (m *Mempool) Ready(accountNonce func(*HashBlock) uint64) (result map[HashBlock][]Transaction) {
+	result = make(map[HashBlock][]Transaction)
+	bySender := make(map[HashBlock]map[uint64]Transaction)
+
+	for _, pending := range m.Pending() {
+		if bySender[pending.From] == nil {
+			bySender[pending.From] = make(map[uint64]Transaction)
+		}
+		if _, exists := bySender[pending.From][pending.Nonce]; !exists {
+			bySender[pending.From][pending.Nonce] = pending
+		}
+	}
+
+	for from, transactions := range bySender {
+		queue := make([]Transaction, 0)
+		for nonce := accountNonce(&from); ; nonce++ {
+			transaction, ok := transactions[nonce]
+			if !ok {
+				break
+			}
+			queue = append(queue, transaction)
+		}
+
+		if len(queue) > 0 {
+			result[from] = queue
+		}
+	}
+
+	return result
+}
@@ -12,7 +12,21 @@ type MerkleNode struct {
 }
 
 type MerkleTree struct {
-	Root *MerkleNode `json:"merkle"`
+	Root   *MerkleNode   `json:"merkle"`
+	Leaves []*MerkleNode `json:"-"`
+}
+
+/* One level of a merkle proof: the sibling hash and the side it sits on */
+type MerkleProofStep struct {
+	Hash HashBlock `json:"hash"`
+	Left bool      `json:"left"`
+}
+
+/* Proof that a transaction hash is part of the merkle tree of a block */
+type MerkleProof struct {
+	BlockId uint64            `json:"block_id"`
+	TxHash  HashBlock         `json:"tx_hash"`
+	Steps   []MerkleProofStep `json:"steps"`
 }
 
 func (m *MerkleNode) buildHash() (result HashBlock, err error) {
@@ -24,29 +38,42 @@ func (m *MerkleNode) buildHash() (result HashBlock, err error) {
 }
 
 func (m *MerkleTree) BuildMarkleTree(transactions []Transaction) (result *MerkleNode, err error) {
+	hashes := make([]HashBlock, 0, len(transactions))
+	for i := range transactions {
+		hashes = append(hashes, transactions[i].Hash)
+	}
+
+	return m.BuildFromHashes(hashes)
+}
+
+/* BuildFromHashes() builds the tree over any list of leaf hashes, such as the receipts of a block */
+func (m *MerkleTree) BuildFromHashes(hashes []HashBlock) (result *MerkleNode, err error) {
 
-	if len(transactions) == 0 {
+	if len(hashes) == 0 {
 		return nil, ErrNoTransactions
 	}
 
-	leaves := make([]Transaction, 0)
-	leaves = append(leaves, transactions...)
+	leaves := make([]HashBlock, 0)
+	leaves = append(leaves, hashes...)
 
 	if len(leaves)%2 == 1 {
 		leaves = append(leaves, leaves[len(leaves)-1])
 	}
 
 	joinLeaves := make([]*MerkleNode, 0)
+	m.Leaves = make([]*MerkleNode, 0)
 
 	for i := 0; i < len(leaves)/2; i++ {
 		item := &MerkleNode{}
-		item.Left = &MerkleNode{Hash: leaves[i*2].Hash}
-		item.Right = &MerkleNode{Hash: leaves[i*2+1].Hash}
+		item.Left = &MerkleNode{Hash: leaves[i*2], Parent: item}
+		item.Right = &MerkleNode{Hash: leaves[i*2+1], Parent: item}
 		item.Hash, err = item.buildHash()
 		joinLeaves = append(joinLeaves, item)
+		m.Leaves = append(m.Leaves, item.Left, item.Right)
 	}
 
 	result = buildNodes(joinLeaves)
+	m.Root = result
 
 	return result, err
 }
@@ -82,3 +109,52 @@ func buildNodes(nodes []*MerkleNode) (result *MerkleNode) {
 
 	return result
 }
+
+/* Walks from the leaf of txHash up to the root collecting the sibling hashes */
+func (m *MerkleTree) Proof(txHash *HashBlock) (result *MerkleProof, err error) {
+	for _, leaf := range m.Leaves {
+		if !leaf.Hash.Equal(txHash) {
+			continue
+		}
+
+		result = &MerkleProof{TxHash: *txHash, Steps: make([]MerkleProofStep, 0)}
+
+		for node := leaf; node.Parent != nil; node = node.Parent {
+			if node.Parent.Left == node {
+				result.Steps = append(result.Steps, MerkleProofStep{Hash: node.Parent.Right.Hash, Left: false})
+			} else {
+				result.Steps = append(result.Steps, MerkleProofStep{Hash: node.Parent.Left.Hash, Left: true})
+			}
+		}
+
+		return result, nil
+	}
+
+	return nil, ErrTransactionNotFound
+}
+
+/* Recomputes the root from the proof and compares it with the expected merkle root */
+func (p *MerkleProof) Verify(root *HashBlock) bool {
+	return VerifyMerkleProof(&p.TxHash, p.Steps, root)
+}
+
+/* Standalone verifier: does not need the block, only the merkle root of its header */
+func VerifyMerkleProof(txHash *HashBlock, steps []MerkleProofStep, root *HashBlock) bool {
+	current := *txHash
+
+	for _, step := range steps {
+		node := &MerkleNode{Left: &MerkleNode{}, Right: &MerkleNode{}}
+
+		if step.Left {
+			node.Left.Hash = step.Hash
+			node.Right.Hash = current
+		} else {
+			node.Left.Hash = current
+			node.Right.Hash = step.Hash
+		}
+
+		current, _ = node.buildHash()
+	}
+
+	return len(steps) > 0 && current.Equal(root)
+}
@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"engine/database"
+	"engine/utils"
+	"io"
+	"log"
+)
+
+const (
+	AccountsDatabaseVersion = 6
+)
+
+/* Layout of the account records up to version 2, which kept the balance in accounts.dat */
+type accountV2 struct {
+	Label      [64]byte
+	Address    HashBlock
+	CreateTime uint64
+	Balance    int64
+	PublicKey  [8192]byte
+	PrivateKey [8192]byte
+}
+
+/* Layout of the account records of versions 3 and 4, with RSA keys padded to fixed size arrays */
+type accountV4 struct {
+	Label      [64]byte
+	Address    HashBlock
+	CreateTime uint64
+	PublicKey  [8192]byte
+	PrivateKey [8192]byte
+}
+
+/* readAccountV5() reads the records of version 5, which kept the private key after the public key */
+func readAccountV5(data []byte) (account Account, privateKey []byte, err error) {
+	buff := bytes.NewReader(data)
+	header := accountHeader{}
+
+	if err = binary.Read(buff, binary.LittleEndian, &header); err != nil {
+		return account, nil, err
+	}
+
+	keys := make([][]byte, 2)
+	for i := range keys {
+		size := uint16(0)
+		if err = binary.Read(buff, binary.LittleEndian, &size); err != nil {
+			return account, nil, err
+		}
+
+		keys[i] = make([]byte, size)
+		if _, err = io.ReadFull(buff, keys[i]); err != nil {
+			return account, nil, err
+		}
+	}
+
+	account = Account{Label: header.Label, Address: header.Address, CreateTime: header.CreateTime, PublicKey: keys[0]}
+	return account, keys[1], nil
+}
+
+/* migrateAccounts() upgrades accounts.dat records. Version 3 drops the balances, 4 derives the addresses from the public keys, 5 tags compact keys with their type and 6 moves the private keys to the keystore */
+func migrateAccounts(db *database.DatabaseFile) (err error) {
+	version := db.Version()
+	if version >= AccountsDatabaseVersion {
+		return nil
+	}
+
+	accounts := make([]Account, 0)
+	privateKeys := make([][]byte, 0)
+	recordSize := binary.Size(accountV4{})
+	if version < 3 {
+		recordSize = binary.Size(accountV2{})
+	}
+
+	db.ForEach(func(data []byte) {
+		if version == 5 {
+			account, privateKey, err := readAccountV5(data)
+			if err != nil {
+				log.Printf("Account record skipped: %s\r\n", err.Error())
+				return
+			}
+
+			accounts = append(accounts, account)
+			privateKeys = append(privateKeys, privateKey)
+			return
+		}
+
+		// Older versions also wrote the transactions into accounts.dat
+		if len(data) != recordSize {
+			return
+		}
+
+		old := accountV4{}
+		if version < 3 {
+			v2 := accountV2{}
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &v2)
+
+			old = accountV4{
+				Label:      v2.Label,
+				Address:    v2.Address,
+				CreateTime: v2.CreateTime,
+				PublicKey:  v2.PublicKey,
+				PrivateKey: v2.PrivateKey,
+			}
+		} else {
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &old)
+		}
+
+		account := Account{
+			Label:      old.Label,
+			Address:    old.Address,
+			CreateTime: old.CreateTime,
+			PublicKey:  tagKey(KeyTypeRSA, utils.TrimDER(old.PublicKey[:])),
+		}
+
+		address := AddressFromPublicKey(account.PublicKey)
+		if !address.Equal(&account.Address) {
+			log.Printf("Account \"%s\" address changed from 0x%x to %s\r\n", bytes.TrimRight(account.Label[:], "\x00"), account.Address[:], EncodeAddress(&address))
+			account.Address = address
+		}
+
+		accounts = append(accounts, account)
+		privateKeys = append(privateKeys, tagKey(KeyTypeRSA, utils.TrimDER(old.PrivateKey[:])))
+	})
+
+	// The private keys are saved before they are removed from accounts.dat
+	for i := range accounts {
+		if Wallet().HasKey(&accounts[i].Address) {
+			continue
+		}
+
+		if err = Wallet().Store(&accounts[i].Address, privateKeys[i], ""); err != nil {
+			return err
+		}
+
+		log.Printf("Private key of the account %s moved to the keystore with an empty passphrase. Set one with the \"passphrase\" command\r\n", accounts[i].EncodedAddress())
+	}
+
+	err = db.Clear()
+	if err != nil {
+		return err
+	}
+
+	for i := range accounts {
+		if err = db.Write(accounts[i].Bytes()); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Migrated %d accounts to version %d\r\n", len(accounts), AccountsDatabaseVersion)
+
+	return db.SetVersion(AccountsDatabaseVersion)
+}
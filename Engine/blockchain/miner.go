@@ -1,11 +1,29 @@
 package blockchain
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"engine/utils"
 	"log"
+	"os"
+	"time"
 
 	"golang.org/x/crypto/sha3"
 )
 
+const (
+	TemplateLifetime      = 30 * time.Second // A block template is rebuilt after this to pick up new transactions
+	TemplateCheckInterval = 4096             // Nonces tried between two checks of the chain tip
+)
+
+type MinerConfig struct {
+	User struct {
+		Wallet   string `json:"wallet"`
+		Password string `json:"password"`
+	} `json:"user"`
+	Pool *Node `json:"pool"`
+}
+
 type Miner struct {
 	Blockchain    *Blockchain
 	ThreadId      int
@@ -18,49 +36,100 @@ func (m *Miner) StartMiner(bc *Blockchain, foundHashCallBack func(*HashBlock, *N
 	go m.RunMiner()
 }
 
+func LoadMinerConfig() (result *MinerConfig, err error) {
+	data, err := os.ReadFile(Net().ConfigFile(MinerConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	result = &MinerConfig{}
+	err = json.Unmarshal(data, result)
+
+	return result, err
+}
+
+/* WalletAddress() returns the account configured to receive the block rewards */
+func (c *MinerConfig) WalletAddress() (result *HashBlock, err error) {
+	if len(c.User.Wallet) == 0 {
+		return nil, ErrNoMinerWallet
+	}
+
+	account, err := (&Account{}).GetAccount(c.User.Wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account.Address, nil
+}
+
 func (m *Miner) Difficulty() uint64 {
 	return m.Blockchain.CurrentBlock().Difficulty
 }
 
 func (m *Miner) RunMiner() {
 
-	block := m.Blockchain.CurrentBlock()
-	targetHash := &block.Hash
-
 	nonce := &Nonce{}
-	nonce.SetBytes(block.Nonce[:])
-	nonce.SetUint64(nonce.Uint64() << (m.ThreadId - 1) << 8)
 
 	for {
-		hashToVerify := GenerateHash(nonce)
-		isItGoodOne := m.VerifyHash(hashToVerify, targetHash)
-
-		if isItGoodOne {
-			newHash, accepted := m.Blockchain.NewHash(hashToVerify, nonce)
-
-			if accepted {
-
-				go func(b *Blockchain, thid int, diff uint64, hsh []byte, n *Nonce) {
-					bkp := log.Prefix()
-					log.SetPrefix("\r\n")
-					log.Printf("[B:%d H:%x N:%032x D:%d T:%d]", b.CurrentBlock().Id, hsh, n.Bytes(), diff, thid)
-					log.SetPrefix(bkp)
-				}(m.Blockchain, m.ThreadId, block.Difficulty, hashToVerify[:], nonce)
-
-				targetHash = newHash
-				block = m.Blockchain.CurrentBlock()
-				if m.foundCallBack != nil {
-					m.foundCallBack(hashToVerify, nonce)
-				}
+		block := m.Blockchain.NewBlock()
+		if block == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if !m.mineTemplate(block, nonce, time.Now().Add(TemplateLifetime)) {
+			continue
+		}
+
+		if _, accepted := m.Blockchain.NewHash(block); accepted {
+
+			go func(b *Blockchain, thid int, diff uint64, hsh []byte, n []byte) {
+				bkp := log.Prefix()
+				log.SetPrefix("\r\n")
+				log.Printf("[B:%d H:%x N:%032x D:%d T:%d]", b.CurrentBlock().Id, hsh, n, diff, thid)
+				log.SetPrefix(bkp)
+			}(m.Blockchain, m.ThreadId, block.Difficulty, block.Hash[:], block.Nonce[:])
+
+			if m.foundCallBack != nil {
+				m.foundCallBack(&block.Hash, nonce)
 			}
 		}
-		nonce.Generate()
 	}
 }
 
-func GenerateHash(nonce *Nonce) (result *HashBlock) {
+/* mineTemplate() tries nonces on the block until its header hash meets the difficulty. It gives up when the chain tip moves or the template expires */
+func (m *Miner) mineTemplate(block *Block, nonce *Nonce, expires time.Time) bool {
+	for i := 0; ; i++ {
+		if i%TemplateCheckInterval == 0 && (time.Now().After(expires) || !m.Blockchain.CurrentBlock().Hash.Equal(&block.Parent)) {
+			return false
+		}
+
+		block.Nonce = *nonce.Generate().Get()
+		hash := block.GenerateHash()
+
+		if m.VerifyHash(hash, &block.Parent) {
+			block.Hash = *hash
+			return true
+		}
+	}
+}
+
+/* GenerateHash() returns the proof of work hash of the block, computed over every header field including the nonce */
+func (b *Block) GenerateHash() (result *HashBlock) {
+	version := make([]byte, 2)
+	binary.LittleEndian.PutUint16(version, b.Version)
+
 	hash := sha3.New256()
-	hash.Write(nonce.Bytes())
+	hash.Write(utils.Uint64ToBytes(b.Id))
+	hash.Write(b.Parent[:])
+	hash.Write(b.Nonce[:])
+	hash.Write(b.Merkle[:])
+	hash.Write(utils.Uint64ToBytes(b.Difficulty))
+	hash.Write(utils.Uint64ToBytes(b.Time))
+	hash.Write(version)
+	hash.Write(b.Coinbase[:])
+	hash.Write(b.StateRoot[:])
+	hash.Write(b.ReceiptsRoot[:])
 	result = &HashBlock{}
 	result.SetBytes(hash.Sum(nil))
 	return result
@@ -76,5 +145,29 @@ func (m *Miner) VerifyHash(hashToVerify *HashBlock, targetHash *HashBlock) bool
 		}
 	}
 
-	return hashToVerify.Compare(targetHash) < 0
+	return !Params().DescendingHashes || hashToVerify.Compare(targetHash) < 0
+}
+
+/* Generate() mines count blocks before returning, used to create blocks on demand on the regtest network */
+func (m *Miner) Generate(count int) (result []Block) {
+	result = make([]Block, 0, count)
+	nonce := &Nonce{}
+
+	for len(result) < count {
+		block := m.Blockchain.NewBlock()
+		if block == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if !m.mineTemplate(block, nonce, time.Now().Add(TemplateLifetime)) {
+			continue
+		}
+
+		if _, accepted := m.Blockchain.NewHash(block); accepted {
+			result = append(result, *m.Blockchain.CurrentBlock())
+		}
+	}
+
+	return result
 }
@@ -0,0 +1,385 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const MaxMultisigKeys = 16
+
+type (
+	/* Key of an m-of-n multisig account. Its address is the hash of the threshold and of the public keys of the signers */
+	MultisigKey struct {
+		Threshold int
+		Keys      [][]byte // Serialized public keys of the signers, sorted so the order they are informed does not change the address
+	}
+
+	PartialSignature struct {
+		Index     int    `json:"index"` // Position of the signer key in the multisig key
+		Signature []byte `json:"signature"`
+	}
+
+	/* Transaction from a multisig account collecting the signatures of the signers until the threshold is met */
+	PartialTransaction struct {
+		Transaction Transaction        `json:"transaction"`
+		Threshold   int                `json:"threshold"`
+		Signatures  []PartialSignature `json:"signatures"`
+	}
+)
+
+func NewMultisigKey(threshold int, keys [][]byte) (result *MultisigKey, err error) {
+	result = &MultisigKey{Threshold: threshold, Keys: make([][]byte, 0, len(keys))}
+
+	for _, key := range keys {
+		keyType, _, err := splitKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if keyType != KeyTypeRSA && keyType != KeyTypeEd25519 {
+			return nil, ErrInvalidMultisig
+		}
+
+		result.Keys = append(result.Keys, key)
+	}
+
+	sort.Slice(result.Keys, func(i, j int) bool {
+		return bytes.Compare(result.Keys[i], result.Keys[j]) < 0
+	})
+
+	for i := 1; i < len(result.Keys); i++ {
+		if bytes.Equal(result.Keys[i-1], result.Keys[i]) {
+			return nil, ErrInvalidMultisig
+		}
+	}
+
+	if len(result.Keys) > MaxMultisigKeys || threshold < 1 || threshold > len(result.Keys) {
+		return nil, ErrInvalidMultisig
+	}
+
+	return result, nil
+}
+
+/* Bytes() serializes the key: the key type, the threshold, the number of keys and each key prefixed by its length */
+func (m *MultisigKey) Bytes() []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteByte(byte(KeyTypeMultisig))
+	buff.WriteByte(byte(m.Threshold))
+	buff.WriteByte(byte(len(m.Keys)))
+
+	for _, key := range m.Keys {
+		binary.Write(buff, binary.LittleEndian, uint16(len(key)))
+		buff.Write(key)
+	}
+
+	return buff.Bytes()
+}
+
+func ParseMultisigKey(data []byte) (result *MultisigKey, err error) {
+	keyType, raw, err := splitKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyType != KeyTypeMultisig || len(raw) < 2 {
+		return nil, ErrInvalidMultisig
+	}
+
+	buff := bytes.NewReader(raw[2:])
+	keys := make([][]byte, int(raw[1]))
+
+	for i := range keys {
+		size := uint16(0)
+		if err = binary.Read(buff, binary.LittleEndian, &size); err != nil {
+			return nil, ErrInvalidMultisig
+		}
+
+		keys[i] = make([]byte, size)
+		if _, err = io.ReadFull(buff, keys[i]); err != nil {
+			return nil, ErrInvalidMultisig
+		}
+	}
+
+	if buff.Len() > 0 {
+		return nil, ErrInvalidMultisig
+	}
+
+	result, err = NewMultisigKey(int(raw[0]), keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys out of order would give a second address to the same signers
+	if !bytes.Equal(result.Bytes(), data) {
+		return nil, ErrInvalidMultisig
+	}
+
+	return result, nil
+}
+
+func (m *MultisigKey) Address() HashBlock {
+	return AddressFromPublicKey(m.Bytes())
+}
+
+/* IndexOf() returns the position of a signer public key, or -1 when it is not a signer */
+func (m *MultisigKey) IndexOf(publicKey []byte) int {
+	for i := range m.Keys {
+		if bytes.Equal(m.Keys[i], publicKey) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+/* SignatureSize() is the size of a signature with the threshold number of the largest signatures of the signers */
+func (m *MultisigKey) SignatureSize() int {
+	sizes := make([]int, 0, len(m.Keys))
+	for _, key := range m.Keys {
+		_, signatureSize := KeyType(key[0]).KeySizes()
+		sizes = append(sizes, signatureSize)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+	result := 2
+	for _, size := range sizes[:m.Threshold] {
+		result += 3 + size
+	}
+
+	return result
+}
+
+/* encodeMultisigSignature() serializes the signatures: the key type, the number of signatures and each signer index and signature */
+func encodeMultisigSignature(signatures []PartialSignature) []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteByte(byte(KeyTypeMultisig))
+	buff.WriteByte(byte(len(signatures)))
+
+	for _, signature := range signatures {
+		buff.WriteByte(byte(signature.Index))
+		binary.Write(buff, binary.LittleEndian, uint16(len(signature.Signature)))
+		buff.Write(signature.Signature)
+	}
+
+	return buff.Bytes()
+}
+
+func decodeMultisigSignature(data []byte) (result []PartialSignature, err error) {
+	keyType, raw, err := splitKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyType != KeyTypeMultisig {
+		return nil, ErrInvalidSignature
+	}
+
+	buff := bytes.NewReader(raw[1:])
+	result = make([]PartialSignature, int(raw[0]))
+
+	for i := range result {
+		index, err := buff.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+
+		size := uint16(0)
+		if err = binary.Read(buff, binary.LittleEndian, &size); err != nil {
+			return nil, ErrInvalidSignature
+		}
+
+		result[i] = PartialSignature{Index: int(index), Signature: make([]byte, size)}
+		if _, err = io.ReadFull(buff, result[i].Signature); err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	if buff.Len() > 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	return result, nil
+}
+
+/* Verify() checks the signature holds valid signatures of exactly the threshold number of signers, in the order of their keys, so it has a single encoding */
+func (m *MultisigKey) Verify(signedData []byte, signature []byte) error {
+	signatures, err := decodeMultisigSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	if len(signatures) < m.Threshold {
+		return ErrThresholdNotMet
+	}
+
+	if len(signatures) > m.Threshold {
+		return ErrInvalidSignature
+	}
+
+	for i, partial := range signatures {
+		if partial.Index >= len(m.Keys) || (i > 0 && partial.Index <= signatures[i-1].Index) {
+			return ErrInvalidSignature
+		}
+
+		if err = verifySignature(m.Keys[partial.Index], signedData, partial.Signature); err != nil {
+			return ErrInvalidSignature
+		}
+	}
+
+	return nil
+}
+
+/* CreateMultisigAccount() registers a multisig account. It has no private key, its transfers are signed by the signers */
+func CreateMultisigAccount(label string, key *MultisigKey) (result *Account, err error) {
+	if len(label) == 0 || len(label) > 64 {
+		return nil, errors.New("account label has invalid length. Maximum length is 64 characters")
+	}
+
+	result = &Account{
+		Address:    key.Address(),
+		CreateTime: uint64(time.Now().Unix()),
+		PublicKey:  key.Bytes(),
+	}
+	copy(result.Label[:], []byte(label))
+
+	if existing, err := FindAccount(&result.Address); err == nil {
+		return existing, nil
+	}
+
+	return result, result.Persist()
+}
+
+/* NewPartialTransaction() creates an unsigned transaction from a local multisig account */
+func NewPartialTransaction(bc *Blockchain, from string, to string, ammount Amount, fee Amount, lockTime uint64) (result *PartialTransaction, err error) {
+	account, err := (&Account{}).GetAccount(from)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseMultisigKey(account.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := newTransfer(bc, account, to, ammount, fee, lockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartialTransaction{Transaction: *transaction, Threshold: key.Threshold, Signatures: make([]PartialSignature, 0)}, nil
+}
+
+/* EstimateMultisigFee() suggests the fee of a transfer from a multisig account signed by the threshold number of signers */
+func (b *Blockchain) EstimateMultisigFee(from string) (Amount, error) {
+	account, err := (&Account{}).GetAccount(from)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := ParseMultisigKey(account.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.estimateFee(len(account.PublicKey), key.SignatureSize(), 0, 0), nil
+}
+
+/* Sign() adds the signature of a local signer account, which must be unlocked in the keystore */
+func (p *PartialTransaction) Sign(signer string) (err error) {
+	key, err := ParseMultisigKey(p.Transaction.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if !p.Transaction.Hash.Equal(p.Transaction.GetHash()) {
+		return ErrInvalidTransactionHash
+	}
+
+	account, err := (&Account{}).GetAccount(signer)
+	if err != nil {
+		return err
+	}
+
+	index := key.IndexOf(account.PublicKey)
+	if index < 0 {
+		return ErrNotASigner
+	}
+
+	signature, err := Wallet().Sign(&account.Address, p.Transaction.Hash[:])
+	if err != nil {
+		return err
+	}
+
+	for i := range p.Signatures {
+		if p.Signatures[i].Index == index {
+			p.Signatures[i].Signature = signature
+			return nil
+		}
+	}
+
+	p.Signatures = append(p.Signatures, PartialSignature{Index: index, Signature: signature})
+	sort.Slice(p.Signatures, func(i, j int) bool {
+		return p.Signatures[i].Index < p.Signatures[j].Index
+	})
+
+	return nil
+}
+
+/* Finalize() returns the transaction with the signatures of the first signers meeting the threshold */
+func (p *PartialTransaction) Finalize() (result *Transaction, err error) {
+	key, err := ParseMultisigKey(p.Transaction.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Signatures) < key.Threshold {
+		return nil, ErrThresholdNotMet
+	}
+
+	result = &Transaction{}
+	*result = p.Transaction
+	result.Signature = encodeMultisigSignature(p.Signatures[:key.Threshold])
+
+	if err = result.VerifySignature(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/* Broadcast() adds the finalized transaction to the mempool */
+func (p *PartialTransaction) Broadcast(bc *Blockchain) (result *Transaction, err error) {
+	result, err = p.Finalize()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, (&Mempool{}).Add(result, bc.AccountNonce)
+}
+
+func LoadPartialTransaction(fileName string) (result *PartialTransaction, err error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &PartialTransaction{}
+	err = json.Unmarshal(data, result)
+
+	return result, err
+}
+
+func (p *PartialTransaction) Save(fileName string) error {
+	data, err := json.MarshalIndent(p, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, data, 0664)
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"engine/database"
+	"path"
+)
+
+/* Settings that keep the nodes and the data of a network apart from the other networks */
+type Network struct {
+	Name          string
+	Magic         uint32 // Sent in every pack, so nodes of different networks do not talk to each other
+	NodePort      int
+	WebPort       int
+	WalletPort    int    // Web port of the wallet routes, on the loopback interface by default
+	AddressPrefix string // Prefix of the encoded account addresses
+	CoinType      uint32 // BIP-44 coin type in the derivation paths of the HD wallet
+	DataDir       string
+	Params        func() *ChainParams // Chain parameters used when the data directory has no chainparams.json
+	Checkpoints   map[uint64]string   // Known block hashes by height. checkpoints.json can add more
+}
+
+const DefaultNetwork = "main"
+
+var Networks = map[string]*Network{
+	"main": {
+		Name:          "main",
+		Magic:         0x48534e00,
+		NodePort:      8085,
+		WebPort:       8080,
+		WalletPort:    8081,
+		AddressPrefix: "hsn",
+		CoinType:      7411,
+		DataDir:       "./db",
+		Params:        DefaultChainParams,
+		Checkpoints: map[uint64]string{
+			0: "0x0814ccd25d2d737d85d5cf2372424b22f544204c1ef48824071b4a4de7ce533e",
+		},
+	},
+	"test": {
+		Name:          "test",
+		Magic:         0x48534e01,
+		NodePort:      18085,
+		WebPort:       18080,
+		WalletPort:    18081,
+		AddressPrefix: "thsn",
+		CoinType:      1,
+		DataDir:       "./db/test",
+		Params: func() *ChainParams {
+			result := DefaultChainParams()
+			result.CoinbaseMaturity = 10
+			return result
+		},
+		Checkpoints: map[uint64]string{
+			0: "0x1bf200dfbae19f59da376fb4fcfff2428591520c6ed80539e98ccf0443c82a72",
+		},
+	},
+	"regtest": {
+		Name:          "regtest",
+		Magic:         0x48534e02,
+		NodePort:      28085,
+		WebPort:       28080,
+		WalletPort:    28081,
+		AddressPrefix: "rhsn",
+		CoinType:      1,
+		DataDir:       "./db/regtest",
+		Params: func() *ChainParams {
+			result := DefaultChainParams()
+			result.HalvingInterval = 150
+			result.CoinbaseMaturity = 10
+			result.StateCheckpointInterval = 10
+			result.DescendingHashes = false
+			return result
+		},
+	},
+}
+
+var currentNetwork = Networks[DefaultNetwork]
+
+/* SelectNetwork() must be called before the chain parameters or any database are used */
+func SelectNetwork(name string) error {
+	network, ok := Networks[name]
+	if !ok {
+		return ErrUnknownNetwork
+	}
+
+	if err := database.UseDatabasePath(network.DataDir); err != nil {
+		return err
+	}
+
+	currentNetwork = network
+	return nil
+}
+
+func Net() *Network {
+	return currentNetwork
+}
+
+/* DataFile() is the path of a file kept in the data directory of the network */
+func (n *Network) DataFile(name string) string {
+	return path.Join(n.DataDir, name)
+}
+
+/* ConfigFile() is the path of a configuration file. The main network keeps them in the working directory */
+func (n *Network) ConfigFile(name string) string {
+	if n.Name == DefaultNetwork {
+		return path.Join(".", name)
+	}
+
+	return n.DataFile(name)
+}
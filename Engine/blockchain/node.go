@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 )
 
 type Node struct {
@@ -14,7 +15,10 @@ type Node struct {
 	Port int    `json:"port"`
 }
 
-var userSelectedPort = 0
+var (
+	userSelectedPort  = 0
+	userSelectedPrune = uint64(0)
+)
 
 func (n *Node) ToString() string {
 	if userSelectedPort > 0 {
@@ -24,50 +28,161 @@ func (n *Node) ToString() string {
 	return fmt.Sprintf(":%d", n.Port)
 }
 
+func (n *Node) Address() string {
+	return fmt.Sprintf("%s:%d", n.Ip, n.Port)
+}
+
 type Config struct {
 	ParentNode *Node   `json:"parent_node"`
 	ThisNode   *Node   `json:"this_node"`
 	ChildNodes []*Node `json:"child_nodes"`
+	Prune      uint64  `json:"prune,omitempty"` // Number of recent blocks whose bodies are kept. Zero keeps every block
 }
 
 type BlockchainNode struct {
 	Configuration     *Config
 	Listener          net.Listener
 	ClientConnections []net.Conn
+	Blockchain        *Blockchain
+	outbound          map[net.Conn]bool // Connections dialed by this node, true once their clock is sampled
+	mutex             sync.Mutex
 }
 
 func (n *BlockchainNode) UsePort(portToUse int) {
 	userSelectedPort = portToUse
 }
 
+/* UsePruning() runs the node in pruned mode, keeping the bodies of the last "keep" blocks */
+func (n *BlockchainNode) UsePruning(keep uint64) {
+	userSelectedPrune = keep
+}
+
+/* loadConfig() uses the default port of the network when there is no nodeconfig.json */
 func (n *BlockchainNode) loadConfig() (err error) {
-	data, err := os.ReadFile(ConfigFileName)
-	if err != nil {
-		return err
+	n.Configuration = &Config{}
+
+	data, err := os.ReadFile(Net().ConfigFile(ConfigFileName))
+	if err == nil {
+		err = json.Unmarshal(data, n.Configuration)
+	} else if os.IsNotExist(err) {
+		err = nil
 	}
 
-	n.Configuration = &Config{}
-	err = json.Unmarshal(data, n.Configuration)
+	if n.Configuration.ThisNode == nil {
+		n.Configuration.ThisNode = &Node{}
+	}
+
+	if n.Configuration.ThisNode.Port == 0 {
+		n.Configuration.ThisNode.Port = Net().NodePort
+	}
 
 	if userSelectedPort > 0 {
 		n.Configuration.ThisNode.Port = userSelectedPort
 	}
 
+	if userSelectedPrune > 0 {
+		n.Configuration.Prune = userSelectedPrune
+	}
+
 	return err
 }
 
+func (n *BlockchainNode) chain() *Blockchain {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.Blockchain == nil {
+		n.Blockchain = &Blockchain{}
+	}
+
+	return n.Blockchain
+}
+
 func (n *BlockchainNode) AddClient(client net.Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
 	n.ClientConnections = append(n.ClientConnections, client)
 }
 
+func (n *BlockchainNode) RemoveClient(client net.Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for i := range n.ClientConnections {
+		if n.ClientConnections[i] == client {
+			n.ClientConnections = append(n.ClientConnections[:i], n.ClientConnections[i+1:]...)
+			break
+		}
+	}
+
+	if n.outbound[client] {
+		RemoveTimeSample(peerHost(client.RemoteAddr()))
+	}
+	delete(n.outbound, client)
+}
+
+/* addOutbound() marks a connection dialed by this node. Only those are trusted for clock samples */
+func (n *BlockchainNode) addOutbound(conn net.Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.outbound == nil {
+		n.outbound = make(map[net.Conn]bool)
+	}
+	n.outbound[conn] = false
+}
+
+/* sampleTime() records the clock of a dialed peer. Accepted connections are ignored, anyone can open many of them */
+func (n *BlockchainNode) sampleTime(conn net.Conn, peerTime uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if sampled, dialed := n.outbound[conn]; dialed && !sampled {
+		n.outbound[conn] = AddTimeSample(peerHost(conn.RemoteAddr()), peerTime)
+	}
+}
+
+/* Peers() returns the open connections, accepted or dialed */
+func (n *BlockchainNode) Peers() []net.Conn {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return append([]net.Conn{}, n.ClientConnections...)
+}
+
 func (n *BlockchainNode) AcceptConnection(client net.Conn) {
 	remaddr := client.RemoteAddr()
 	log.Printf("New connection %s %s\r\n", remaddr.Network(), remaddr.String())
 	defer client.Close()
 
 	n.AddClient(client)
-	n.Send(client, CMD_WELCOME, []byte("Welcome!"), 0, "Success")
+	defer n.RemoveClient(client)
+
+	n.SendWelcome(client)
+	n.readPacks(client)
+}
+
+/* ConnectPeer() dials another node and handles its packs like the ones of an accepted connection */
+func (n *BlockchainNode) ConnectPeer(peer *Node) {
+	conn, err := net.Dial("tcp4", peer.Address())
+	if err != nil {
+		log.Printf("Cannot connect to the node %s: %s\r\n", peer.Address(), err.Error())
+		return
+	}
+	defer conn.Close()
+
+	log.Printf("Connected to the node %s\r\n", peer.Address())
 
+	n.AddClient(conn)
+	n.addOutbound(conn)
+	defer n.RemoveClient(conn)
+
+	n.SendWelcome(conn)
+	n.readPacks(conn)
+}
+
+func (n *BlockchainNode) readPacks(client net.Conn) {
 	strBuffer := ""
 	log.SetPrefix("\r")
 
@@ -95,9 +210,17 @@ func (n *BlockchainNode) AcceptConnection(client net.Conn) {
 			pack := &DataPack{}
 			err := json.Unmarshal([]byte(strPack), pack)
 
+			if err == nil && pack.Magic != Net().Magic {
+				n.Send(client, CMD_ERROR, nil, ERR_WRONG_NETWORK, ErrWrongNetwork.Error())
+				log.Printf("Disconnecting %s: %s\r\n", client.RemoteAddr(), ErrWrongNetwork.Error())
+				return
+			}
+
 			if err != nil {
 				n.Send(client, CMD_ERROR, []byte("Error parsing json data"), ERR_JSON_PARSING, err.Error())
 				log.Printf("Error from %s: %s\r\n", client.RemoteAddr(), err.Error())
+			} else {
+				n.handlePack(client, pack)
 			}
 
 			strBuffer = strBuffer[packEndPos+1:]
@@ -134,7 +257,20 @@ func (n *BlockchainNode) StartListener() {
 	err := n.loadConfig()
 
 	if err != nil {
-		log.Fatalf("Error loading config.json: %s\r\n", err.Error())
+		log.Fatalf("Error loading %s: %s\r\n", ConfigFileName, err.Error())
 	}
+
+	if n.Configuration.Prune > 0 {
+		if n.Configuration.Prune < MinPruneKeep() {
+			log.Fatalf("Cannot keep only %d blocks: %s\r\n", n.Configuration.Prune, ErrPruneTooDeep.Error())
+		}
+
+		n.chain().StartPruning(n.Configuration.Prune)
+	}
+
 	go n.RunServerNode()
+
+	if n.Configuration.ParentNode != nil {
+		go n.ConnectPeer(n.Configuration.ParentNode)
+	}
 }
@@ -2,19 +2,51 @@ package blockchain
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net"
+	"strings"
+	"time"
 )
 
 const (
-	CMD_WELCOME = 0x01
-	CMD_ERROR   = 0x02
+	CMD_WELCOME  = 0x01 // Data is the json of a WelcomeMessage
+	CMD_ERROR    = 0x02
+	CMD_BLOCK    = 0x03 // Data is the json of a block
+	CMD_GETBLOCK = 0x04 // Data is the hash of the requested block
+
+	CMD_GETHEADERS = 0x05 // Data is the json of a HeadersRequest
+	CMD_HEADERS    = 0x06 // Data is the json of the headers of the main chain
+	CMD_GETPROOF   = 0x07 // Data is the json of a PaymentProofRequest
+	CMD_PROOF      = 0x08 // Data is the json of a PaymentProof
+	CMD_GETORPHANS = 0x09 // Data is empty
+	CMD_ORPHANS    = 0x0a // Data is the json of the OrphanMetrics of the node
 )
 
 const (
-	ERR_JSON_PARSING = 0x01
+	ERR_JSON_PARSING    = 0x01
+	ERR_BLOCK_NOT_FOUND = 0x02
+	ERR_INVALID_BLOCK   = 0x03
+	ERR_WRONG_NETWORK   = 0x04
+	ERR_BLOCK_PRUNED    = 0x05
+	ERR_TX_NOT_FOUND    = 0x06
 )
 
+const MaxHeadersPerPack = 500
+
+/* Sent by both sides of a new connection. The peer times adjust the clock used to validate block times */
+type WelcomeMessage struct {
+	Time         uint64 `json:"time"`
+	PrunedHeight uint64 `json:"pruned_height,omitempty"` // The node cannot serve the blocks below this id
+}
+
+type HeadersRequest struct {
+	From  uint64 `json:"from"` // Id of the first header
+	Count int    `json:"count"`
+}
+
 type DataPack struct {
+	Magic     uint32 `json:"m"`
 	Command   uint8  `json:"c"`
 	ErrorCode uint8  `json:"ec"`
 	ErrorMsg  string `json:"em"`
@@ -22,8 +54,13 @@ type DataPack struct {
 }
 
 func (n *BlockchainNode) Send(conn net.Conn, cmd uint8, data []byte, errCode uint8, errMsg string) (err error) {
+	return sendPack(conn, cmd, data, errCode, errMsg)
+}
+
+func sendPack(conn net.Conn, cmd uint8, data []byte, errCode uint8, errMsg string) (err error) {
 
 	pack := DataPack{
+		Magic:     Net().Magic,
 		Command:   cmd,
 		ErrorCode: errCode,
 		ErrorMsg:  errMsg,
@@ -35,3 +72,138 @@ func (n *BlockchainNode) Send(conn net.Conn, cmd uint8, data []byte, errCode uin
 	_, err = conn.Write(bytes)
 	return err
 }
+
+func (n *BlockchainNode) SendWelcome(conn net.Conn) (err error) {
+	data, err := json.Marshal(&WelcomeMessage{Time: uint64(time.Now().Unix()), PrunedHeight: n.chain().PrunedHeight()})
+	if err != nil {
+		return err
+	}
+
+	return n.Send(conn, CMD_WELCOME, data, 0, "Success")
+}
+
+func (n *BlockchainNode) SendBlock(conn net.Conn, block *Block) (err error) {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	return n.Send(conn, CMD_BLOCK, data, 0, "")
+}
+
+/* RequestBlock() asks the peer that sent an orphan, and then the other peers, for its missing ancestor */
+func (n *BlockchainNode) RequestBlock(from net.Conn, hash *HashBlock) {
+	n.Send(from, CMD_GETBLOCK, hash[:], 0, "")
+
+	for _, peer := range n.Peers() {
+		if peer != from {
+			n.Send(peer, CMD_GETBLOCK, hash[:], 0, "")
+		}
+	}
+}
+
+func (n *BlockchainNode) handlePack(conn net.Conn, pack *DataPack) {
+	switch pack.Command {
+	case CMD_WELCOME:
+		welcome := &WelcomeMessage{}
+		if err := json.Unmarshal(pack.Data, welcome); err == nil {
+			n.sampleTime(conn, welcome.Time)
+		}
+
+		if welcome.PrunedHeight > 0 {
+			log.Printf("Node %s is pruned, it has no blocks below %d\r\n", conn.RemoteAddr(), welcome.PrunedHeight)
+		}
+
+	case CMD_BLOCK:
+		block := &Block{}
+		if err := json.Unmarshal(pack.Data, block); err != nil {
+			n.Send(conn, CMD_ERROR, nil, ERR_JSON_PARSING, err.Error())
+			return
+		}
+
+		missing, err := n.chain().ProcessBlock(block)
+		if errors.Is(err, ErrOrphanBlock) {
+			n.RequestBlock(conn, missing)
+		} else if err != nil && !errors.Is(err, ErrBlockKnown) {
+			log.Printf("Block %d from %s rejected: %s\r\n", block.Id, conn.RemoteAddr(), err.Error())
+			n.Send(conn, CMD_ERROR, block.Hash[:], ERR_INVALID_BLOCK, err.Error())
+		}
+
+	case CMD_GETBLOCK:
+		hash := &HashBlock{}
+		hash.SetBytes(pack.Data)
+
+		block, err := n.chain().BlockByHash(hash)
+		if errors.Is(err, ErrBlockPruned) {
+			n.Send(conn, CMD_ERROR, hash[:], ERR_BLOCK_PRUNED, err.Error())
+			return
+		}
+
+		if err != nil {
+			n.Send(conn, CMD_ERROR, hash[:], ERR_BLOCK_NOT_FOUND, err.Error())
+			return
+		}
+
+		n.SendBlock(conn, block)
+
+	case CMD_GETHEADERS:
+		request := &HeadersRequest{}
+		if err := json.Unmarshal(pack.Data, request); err != nil {
+			n.Send(conn, CMD_ERROR, nil, ERR_JSON_PARSING, err.Error())
+			return
+		}
+
+		data, _ := json.Marshal(n.chain().Headers(request.From, request.Count))
+		n.Send(conn, CMD_HEADERS, data, 0, "")
+
+	case CMD_GETPROOF:
+		request := &PaymentProofRequest{}
+		if err := json.Unmarshal(pack.Data, request); err != nil {
+			n.Send(conn, CMD_ERROR, nil, ERR_JSON_PARSING, err.Error())
+			return
+		}
+
+		proof, err := n.chain().PaymentProof(request)
+		if errors.Is(err, ErrBlockPruned) {
+			n.Send(conn, CMD_ERROR, nil, ERR_BLOCK_PRUNED, err.Error())
+			return
+		}
+
+		if err != nil {
+			n.Send(conn, CMD_ERROR, nil, ERR_TX_NOT_FOUND, err.Error())
+			return
+		}
+
+		data, _ := json.Marshal(proof)
+		n.Send(conn, CMD_PROOF, data, 0, "")
+
+	case CMD_GETORPHANS:
+		data, _ := json.Marshal(n.chain().OrphanMetrics())
+		n.Send(conn, CMD_ORPHANS, data, 0, "")
+	}
+}
+
+/* readPack() returns the next pack of the connection, keeping the bytes of the following packs in buffer */
+func readPack(conn net.Conn, buffer *string) (result *DataPack, err error) {
+	for {
+		if end := strings.IndexByte(*buffer, '}'); end > 0 {
+			result = &DataPack{}
+			err = json.Unmarshal([]byte((*buffer)[:end+1]), result)
+			*buffer = (*buffer)[end+1:]
+
+			if err == nil && result.Magic != Net().Magic {
+				err = ErrWrongNetwork
+			}
+
+			return result, err
+		}
+
+		var data [8192]byte
+		count, err := conn.Read(data[:])
+		if err != nil {
+			return nil, err
+		}
+
+		*buffer += string(data[:count])
+	}
+}
@@ -0,0 +1,219 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	orphanBlock struct {
+		block    Block
+		received time.Time
+	}
+
+	/* Blocks received before their parent, waiting for the missing ancestors */
+	OrphanPool struct {
+		mutex    sync.Mutex
+		orphans  map[HashBlock]*orphanBlock
+		byParent map[HashBlock][]HashBlock
+		metrics  OrphanMetrics
+	}
+
+	OrphanMetrics struct {
+		Count     int    `json:"count"`     // Orphans currently in the pool
+		Added     uint64 `json:"added"`     // Orphans received since the node started
+		Connected uint64 `json:"connected"` // Orphans connected after their parent arrived
+		Evicted   uint64 `json:"evicted"`   // Orphans dropped because the pool was full
+		Expired   uint64 `json:"expired"`   // Orphans dropped because their parent never arrived
+	}
+)
+
+func NewOrphanPool() *OrphanPool {
+	return &OrphanPool{
+		orphans:  make(map[HashBlock]*orphanBlock),
+		byParent: make(map[HashBlock][]HashBlock),
+	}
+}
+
+/* Add() keeps the block and returns the hash of the oldest missing ancestor to request from the peers */
+func (p *OrphanPool) Add(block *Block) (missing HashBlock) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.expire()
+
+	if _, exists := p.orphans[block.Hash]; !exists {
+		for len(p.orphans) >= Params().MaxOrphanBlocks && len(p.orphans) > 0 {
+			p.remove(p.oldest())
+			p.metrics.Evicted++
+		}
+
+		if Params().MaxOrphanBlocks > 0 {
+			p.orphans[block.Hash] = &orphanBlock{block: *block, received: time.Now()}
+			p.byParent[block.Parent] = append(p.byParent[block.Parent], block.Hash)
+			p.metrics.Added++
+		}
+	}
+
+	missing = block.Parent
+	for orphan, ok := p.orphans[missing]; ok; orphan, ok = p.orphans[missing] {
+		missing = orphan.block.Parent
+	}
+
+	return missing
+}
+
+/* Take() removes and returns the orphans whose parent is the given block */
+func (p *OrphanPool) Take(parent *HashBlock) (result []Block) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	result = make([]Block, 0)
+	children := append([]HashBlock{}, p.byParent[*parent]...)
+
+	for _, hash := range children {
+		if orphan, ok := p.orphans[hash]; ok {
+			result = append(result, orphan.block)
+			p.remove(hash)
+		}
+	}
+
+	p.metrics.Connected += uint64(len(result))
+
+	return result
+}
+
+func (p *OrphanPool) Metrics() OrphanMetrics {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.expire()
+
+	result := p.metrics
+	result.Count = len(p.orphans)
+	return result
+}
+
+/* expire() drops the orphans older than MaxOrphanAge. Needs the mutex locked */
+func (p *OrphanPool) expire() {
+	maxAge := time.Duration(Params().MaxOrphanAge) * time.Second
+
+	for hash, orphan := range p.orphans {
+		if time.Since(orphan.received) > maxAge {
+			p.remove(hash)
+			p.metrics.Expired++
+		}
+	}
+}
+
+func (p *OrphanPool) oldest() (result HashBlock) {
+	var received time.Time
+
+	for hash, orphan := range p.orphans {
+		if received.IsZero() || orphan.received.Before(received) {
+			result = hash
+			received = orphan.received
+		}
+	}
+
+	return result
+}
+
+func (p *OrphanPool) remove(hash HashBlock) {
+	orphan, ok := p.orphans[hash]
+	if !ok {
+		return
+	}
+	delete(p.orphans, hash)
+
+	siblings := p.byParent[orphan.block.Parent]
+	for i := range siblings {
+		if siblings[i].Equal(&hash) {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(p.byParent, orphan.block.Parent)
+	} else {
+		p.byParent[orphan.block.Parent] = siblings
+	}
+}
+
+func (b *Blockchain) orphanPool() *OrphanPool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.orphans == nil {
+		b.orphans = NewOrphanPool()
+	}
+
+	return b.orphans
+}
+
+func (b *Blockchain) OrphanMetrics() OrphanMetrics {
+	return b.orphanPool().Metrics()
+}
+
+/* FetchOrphanMetrics() asks the node at peer for the metrics of its orphan pool, which only lives in the memory of the node */
+func FetchOrphanMetrics(peer string) (result *OrphanMetrics, err error) {
+	conn, err := net.DialTimeout("tcp4", peer, LightClientTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buffer := ""
+	data, err := request(conn, &buffer, CMD_GETORPHANS, nil, CMD_ORPHANS)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &OrphanMetrics{}
+	return result, json.Unmarshal(data, result)
+}
+
+/* ProcessBlock() adds a block received from a peer, keeping it as an orphan and returning the missing ancestor when its parent is unknown */
+func (b *Blockchain) ProcessBlock(block *Block) (missing *HashBlock, err error) {
+	err = b.AddBlock(block)
+
+	if errors.Is(err, ErrOrphanBlock) {
+		if err = block.CheckHash(); err != nil {
+			return nil, err
+		}
+
+		parent := b.orphanPool().Add(block)
+		metrics := b.OrphanMetrics()
+		log.Printf("Orphan block %d 0x%x kept, %d orphans in the pool (%d evicted, %d expired)\r\n",
+			block.Id, block.Hash[:], metrics.Count, metrics.Evicted, metrics.Expired)
+
+		return &parent, ErrOrphanBlock
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	parents := []HashBlock{block.Hash}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		for _, orphan := range b.orphanPool().Take(&parent) {
+			if err := b.AddBlock(&orphan); err != nil {
+				log.Printf("Orphan block %d 0x%x rejected: %s\r\n", orphan.Id, orphan.Hash[:], err.Error())
+				continue
+			}
+
+			log.Printf("Orphan block %d 0x%x connected\r\n", orphan.Id, orphan.Hash[:])
+			parents = append(parents, orphan.Hash)
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/utils"
+	"log"
+	"os"
+	"sync"
+)
+
+/* Consensus parameters shared by every node of the network */
+type ChainParams struct {
+	InitialSubsidy   Amount `json:"initial_subsidy"`   // Coins created by each block before the first halving
+	HalvingInterval  uint64 `json:"halving_interval"`  // Number of blocks between two halvings of the subsidy
+	CoinbaseMaturity uint64 `json:"coinbase_maturity"` // Number of blocks before a block reward can be spent
+
+	MinRelayFeeRate     Amount `json:"min_relay_fee_rate"`     // Minimum fee per byte to accept a transaction into the mempool
+	MinInclusionFeeRate Amount `json:"min_inclusion_fee_rate"` // Minimum fee per byte to include a transaction in a block
+	MaxBlockSize        int    `json:"max_block_size"`         // Maximum size in bytes of the transactions of a block
+	FeeEstimateBlocks   int    `json:"fee_estimate_blocks"`    // Number of recent blocks used by the fee estimator
+
+	StateCheckpointInterval uint64 `json:"state_checkpoint_interval"` // Number of blocks between two snapshots of the ledger state
+	MaxReorgDepth           uint64 `json:"max_reorg_depth"`           // Maximum number of blocks a reorganisation can disconnect
+
+	GasPrice          Amount `json:"gas_price"`           // Fee paid for each unit of the gas limit of a contract transaction
+	MaxTransactionGas uint64 `json:"max_transaction_gas"` // Maximum gas limit of a transaction
+	MaxBlockGas       uint64 `json:"max_block_gas"`       // Maximum sum of the gas limits of the transactions of a block
+
+	MaxOrphanBlocks int    `json:"max_orphan_blocks"` // Maximum number of blocks waiting for their parent
+	MaxOrphanAge    uint64 `json:"max_orphan_age"`    // Seconds an orphan block waits for its parent before being evicted
+
+	MedianTimeBlocks int    `json:"median_time_blocks"` // Number of previous blocks whose median time a block time must exceed
+	MaxFutureDrift   uint64 `json:"max_future_drift"`   // Seconds a block time can be ahead of the network adjusted time
+
+	DescendingHashes bool `json:"descending_hashes"` // Each block hash must be lower than the hash of its parent
+}
+
+var (
+	chainParams     *ChainParams
+	chainParamsOnce sync.Once
+)
+
+func DefaultChainParams() *ChainParams {
+	return &ChainParams{
+		InitialSubsidy:   50 * CoinUnits,
+		HalvingInterval:  210000,
+		CoinbaseMaturity: 100,
+
+		MinRelayFeeRate:     1000,
+		MinInclusionFeeRate: 1000,
+		MaxBlockSize:        1000000,
+		FeeEstimateBlocks:   10,
+
+		StateCheckpointInterval: 100,
+		MaxReorgDepth:           100,
+
+		GasPrice:          10,
+		MaxTransactionGas: 1000000,
+		MaxBlockGas:       10000000,
+
+		MaxOrphanBlocks: 100,
+		MaxOrphanAge:    1200,
+
+		MedianTimeBlocks: 11,
+		MaxFutureDrift:   7200,
+
+		DescendingHashes: true,
+	}
+}
+
+/* Params() returns the chain parameters, loading the chainparams.json of the network over its defaults when it exists */
+func Params() *ChainParams {
+	chainParamsOnce.Do(func() {
+		chainParams = Net().Params()
+		fileName := Net().DataFile(ChainParamsFileName)
+
+		if !utils.FileExists(fileName) {
+			return
+		}
+
+		data, err := os.ReadFile(fileName)
+		if err == nil {
+			err = json.Unmarshal(data, chainParams)
+		}
+
+		if err != nil {
+			log.Panicf("Error loading %s: %s\r\n", fileName, err.Error())
+		}
+	})
+
+	return chainParams
+}
+
+/* Subsidy() returns the block reward of the given height, halved every HalvingInterval blocks */
+func (p *ChainParams) Subsidy(height uint64) Amount {
+	if p.HalvingInterval == 0 {
+		return p.InitialSubsidy
+	}
+
+	halvings := height / p.HalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+
+	return p.InitialSubsidy >> halvings
+}
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/database"
+	"log"
+	"time"
+)
+
+const PruneInterval = 10 * time.Minute
+
+/* IsPruned() tells whether only the header of the block is kept */
+func (b *Block) IsPruned() bool {
+	return b.Pruned
+}
+
+/* Header() is the block without its transactions */
+func (b *Block) Header() Block {
+	result := *b
+	result.Transactions = nil
+	result.Pruned = true
+	return result
+}
+
+/* MinPruneKeep() is the number of recent blocks whose bodies reorganisations, coinbase maturity and fee estimation need */
+func MinPruneKeep() uint64 {
+	result := Params().MaxReorgDepth
+	if Params().CoinbaseMaturity > result {
+		result = Params().CoinbaseMaturity
+	}
+
+	if uint64(Params().FeeEstimateBlocks) > result {
+		result = uint64(Params().FeeEstimateBlocks)
+	}
+
+	return result
+}
+
+/* PrunedHeight() is the id of the first block whose body is kept. Peers cannot request the blocks below it */
+func (b *Blockchain) PrunedHeight() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+
+	return b.prunedHeight()
+}
+
+/* prunedHeight() must be called with the blockchain mutex locked */
+func (b *Blockchain) prunedHeight() (result uint64) {
+	for result < uint64(len(b.Blocks)) && b.Blocks[result].IsPruned() {
+		result++
+	}
+
+	return result
+}
+
+/* Prune() drops the bodies of the blocks older than the last "keep" ones, down to a state checkpoint the ledger can be restored from */
+func (b *Blockchain) Prune(keep uint64) (result uint64, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if keep < MinPruneKeep() {
+		return 0, ErrPruneTooDeep
+	}
+
+	b.loadIndex()
+	result = b.prunedHeight()
+
+	count := uint64(len(b.Blocks))
+	if count <= keep {
+		return result, nil
+	}
+
+	// The state must be restorable without replaying pruned blocks, so the bodies are only dropped below a checkpoint
+	height := result
+	for _, checkpoint := range loadStateCheckpoints() {
+		if checkpoint.Height > height && checkpoint.Height <= count-keep && checkpoint.BlockHash.Equal(&b.Blocks[checkpoint.Height-1].Hash) {
+			height = checkpoint.Height
+		}
+	}
+
+	if height == result {
+		return result, nil
+	}
+
+	records := make([][]byte, 0, len(b.Blocks))
+	for i := range b.Blocks {
+		block := b.Blocks[i]
+		if uint64(i) < height {
+			block = block.Header()
+		}
+
+		data, err := json.Marshal(&block)
+		if err != nil {
+			return result, err
+		}
+		records = append(records, data)
+	}
+
+	dat := database.BlockDB{}
+	if err = dat.Replace(records); err != nil {
+		return result, err
+	}
+
+	for i := result; i < height; i++ {
+		b.Blocks[i] = b.Blocks[i].Header()
+		if node, ok := b.index[b.Blocks[i].Hash]; ok {
+			node.Block = b.Blocks[i]
+		}
+	}
+
+	return height, nil
+}
+
+/* StartPruning() prunes the chain in the background, now and every PruneInterval */
+func (b *Blockchain) StartPruning(keep uint64) {
+	go func() {
+		for {
+			before := b.PrunedHeight()
+			height, err := b.Prune(keep)
+			if err != nil {
+				log.Printf("Error pruning the blockchain: %s\r\n", err.Error())
+				return
+			}
+
+			if height > before {
+				log.Printf("Pruned the bodies of the blocks below %d\r\n", height)
+			}
+
+			time.Sleep(PruneInterval)
+		}
+	}()
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"engine/database"
+	"engine/utils"
+	"errors"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	ReceiptFailed  = uint8(0)
+	ReceiptSuccess = uint8(1)
+)
+
+type (
+	/* Entry emitted by the LOG instructions of a contract */
+	ReceiptLog struct {
+		Address HashBlock   `json:"address"` // Contract that emitted the entry
+		Topics  []HashBlock `json:"topics"`
+		Data    HashBlock   `json:"data"`
+	}
+
+	/* Outcome of a transaction applied to the state */
+	Receipt struct {
+		Transaction HashBlock    `json:"transaction"` // ID of the transaction
+		BlockId     uint64       `json:"block_id"`
+		BlockHash   HashBlock    `json:"block_hash"`
+		Index       uint32       `json:"index"` // Position of the transaction in the block
+		Status      uint8        `json:"status"`
+		Fee         Amount       `json:"fee"`
+		GasUsed     uint64       `json:"gas_used"`
+		Contract    *HashBlock   `json:"contract,omitempty"` // Address of the contract created by a deployment
+		Return      []byte       `json:"return,omitempty"`
+		Error       string       `json:"error,omitempty"`
+		Logs        []ReceiptLog `json:"logs"`
+	}
+
+	/* Receipts of the transactions of a block, saved in receipts.dat when the block is connected */
+	BlockReceipts struct {
+		BlockId   uint64    `json:"block_id"`
+		BlockHash HashBlock `json:"block_hash"`
+		Receipts  []Receipt `json:"receipts"`
+	}
+)
+
+/* GetHash() commits to everything but the block hash, which is only known once the block is mined */
+func (r *Receipt) GetHash() (result HashBlock) {
+	index := make([]byte, 4)
+	binary.LittleEndian.PutUint32(index, r.Index)
+
+	hash := sha3.New256()
+	hash.Write(r.Transaction[:])
+	hash.Write(utils.Uint64ToBytes(r.BlockId))
+	hash.Write(index)
+	hash.Write([]byte{r.Status})
+	hash.Write(utils.Uint64ToBytes(uint64(r.Fee)))
+	hash.Write(utils.Uint64ToBytes(r.GasUsed))
+	if r.Contract != nil {
+		hash.Write(r.Contract[:])
+	}
+	hash.Write(utils.Uint64ToBytes(uint64(len(r.Return))))
+	hash.Write(r.Return)
+	hash.Write(utils.Uint64ToBytes(uint64(len(r.Error))))
+	hash.Write([]byte(r.Error))
+
+	for _, log := range r.Logs {
+		hash.Write(log.Address[:])
+		hash.Write([]byte{uint8(len(log.Topics))})
+		for _, topic := range log.Topics {
+			hash.Write(topic[:])
+		}
+		hash.Write(log.Data[:])
+	}
+
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* ReceiptsRoot() is the merkle root of the receipt hashes committed in the block header */
+func ReceiptsRoot(receipts []Receipt) (result HashBlock) {
+	hashes := make([]HashBlock, 0, len(receipts))
+	for i := range receipts {
+		hashes = append(hashes, receipts[i].GetHash())
+	}
+
+	tree := &MerkleTree{}
+	if root, err := tree.BuildFromHashes(hashes); err == nil {
+		result = root.Hash
+	}
+
+	return result
+}
+
+func saveReceipts(block *Block, receipts []Receipt) (err error) {
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	for i := range receipts {
+		receipts[i].BlockHash = block.Hash
+	}
+
+	db := &database.DatabaseFile{}
+	err = db.Open(database.ReceiptsFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	data, err := json.Marshal(&BlockReceipts{BlockId: block.Id, BlockHash: block.Hash, Receipts: receipts})
+	if err != nil {
+		return err
+	}
+
+	return db.Write(data)
+}
+
+func loadReceipts() (result []BlockReceipts) {
+	db := &database.DatabaseFile{}
+	err := db.Open(database.ReceiptsFileName)
+	defer db.Close()
+
+	result = make([]BlockReceipts, 0)
+	if err != nil {
+		return result
+	}
+
+	db.ForEach(func(data []byte) {
+		receipts := BlockReceipts{}
+		if json.Unmarshal(data, &receipts) == nil {
+			result = append(result, receipts)
+		}
+	})
+
+	return result
+}
+
+/* ClearReceipts() empties receipts.dat, so a rebuild of the state can save the receipts of every block again */
+func ClearReceipts() (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.ReceiptsFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	return db.Clear()
+}
+
+/* Receipt() finds the receipt of the transaction in the blocks of the main chain */
+func (b *Blockchain) Receipt(id *HashBlock) (result *Receipt, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+	saved := loadReceipts()
+
+	for i := len(saved) - 1; i >= 0; i-- {
+		blockReceipts := &saved[i]
+		if blockReceipts.BlockId >= uint64(len(b.Blocks)) || !b.Blocks[blockReceipts.BlockId].Hash.Equal(&blockReceipts.BlockHash) {
+			continue
+		}
+
+		for j := range blockReceipts.Receipts {
+			if blockReceipts.Receipts[j].Transaction.Equal(id) {
+				return &blockReceipts.Receipts[j], nil
+			}
+		}
+	}
+
+	return nil, ErrReceiptNotFound
+}
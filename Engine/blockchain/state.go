@@ -0,0 +1,602 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"engine/database"
+	"errors"
+	"log"
+)
+
+type (
+	/* Account balances, nonces and contracts resulting from applying the blocks from the genesis */
+	LedgerState struct {
+		Height    uint64 // Number of blocks applied to the state
+		BlockHash HashBlock
+		Balances  map[HashBlock]Amount
+		Nonces    map[HashBlock]uint64
+		Code      map[HashBlock][]byte                  // Bytecode of the deployed contracts
+		Storage   map[HashBlock]map[HashBlock]HashBlock // Storage slots of the contracts. Zero slots are not kept
+	}
+
+	/* Values the accounts had before a block was applied, used to disconnect the block */
+	StateUndo struct {
+		Height    uint64
+		BlockHash HashBlock
+		Balances  map[HashBlock]Amount
+		Nonces    map[HashBlock]uint64
+		Code      map[HashBlock][]byte // Nil when the contract did not exist
+		Storage   map[HashBlock]map[HashBlock]HashBlock
+	}
+
+	/* Changes of a block to the state, applied to it only when every transaction is valid */
+	stateChanges struct {
+		state    *LedgerState
+		balances map[HashBlock]Amount
+		nonces   map[HashBlock]uint64
+		code     map[HashBlock][]byte
+		storage  map[HashBlock]map[HashBlock]HashBlock
+	}
+
+	StorageSlot struct {
+		Key   HashBlock `json:"key"`
+		Value HashBlock `json:"value"`
+	}
+
+	StateEntry struct {
+		Address HashBlock     `json:"address"`
+		Balance Amount        `json:"balance"`
+		Nonce   uint64        `json:"nonce"`
+		Code    []byte        `json:"code,omitempty"`
+		Storage []StorageSlot `json:"storage,omitempty"`
+	}
+
+	/* Snapshot of the ledger state saved in state.dat */
+	StateCheckpoint struct {
+		Height    uint64       `json:"height"`
+		BlockHash HashBlock    `json:"block_hash"`
+		Entries   []StateEntry `json:"entries"`
+	}
+)
+
+func NewLedgerState() *LedgerState {
+	return &LedgerState{
+		Balances: make(map[HashBlock]Amount),
+		Nonces:   make(map[HashBlock]uint64),
+		Code:     make(map[HashBlock][]byte),
+		Storage:  make(map[HashBlock]map[HashBlock]HashBlock),
+	}
+}
+
+func (s *LedgerState) Balance(address *HashBlock) Amount {
+	return s.Balances[*address]
+}
+
+func (s *LedgerState) Nonce(address *HashBlock) uint64 {
+	return s.Nonces[*address]
+}
+
+/* Apply() moves the coins of the block transactions and runs their contract code. Nothing changes when a transaction is invalid */
+func (s *LedgerState) Apply(block *Block) (undo *StateUndo, receipts []Receipt, err error) {
+	if block.Id != s.Height {
+		return nil, nil, ErrStateOutOfOrder
+	}
+
+	changes := s.changes()
+	receipts = make([]Receipt, 0)
+
+	for i := range block.Transactions {
+		transaction := &block.Transactions[i]
+		if transaction.Ammount < 0 || transaction.Fee < 0 {
+			return nil, nil, ErrInvalidAmount
+		}
+
+		if !transaction.IsCoinbase() {
+			if transaction.Nonce < changes.nonce(transaction.From) {
+				return nil, nil, ErrNonceUsed
+			}
+
+			if transaction.Nonce > changes.nonce(transaction.From) {
+				return nil, nil, ErrNonceGap
+			}
+
+			total, err := transaction.Ammount.Add(transaction.Fee)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			balance, err := changes.balance(transaction.From).Sub(total)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if balance < 0 {
+				return nil, nil, ErrInsufficientFunds
+			}
+
+			changes.balances[transaction.From] = balance
+			changes.nonces[transaction.From] = transaction.Nonce + 1
+		}
+
+		if transaction.IsContract() {
+			receipt, err := changes.execute(transaction, block)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			receipt.BlockId, receipt.Index, receipt.Fee = block.Id, uint32(i), transaction.Fee
+			receipts = append(receipts, *receipt)
+			continue
+		}
+
+		if err = changes.credit(transaction.To, transaction.Ammount); err != nil {
+			return nil, nil, err
+		}
+
+		receipts = append(receipts, Receipt{
+			Transaction: transaction.ID,
+			BlockId:     block.Id,
+			Index:       uint32(i),
+			Status:      ReceiptSuccess,
+			Fee:         transaction.Fee,
+			Logs:        make([]ReceiptLog, 0),
+		})
+	}
+
+	undo = s.commit(changes)
+	s.Height++
+	s.BlockHash = block.Hash
+
+	return undo, receipts, nil
+}
+
+func (s *LedgerState) changes() *stateChanges {
+	return &stateChanges{
+		state:    s,
+		balances: make(map[HashBlock]Amount),
+		nonces:   make(map[HashBlock]uint64),
+		code:     make(map[HashBlock][]byte),
+		storage:  make(map[HashBlock]map[HashBlock]HashBlock),
+	}
+}
+
+func (c *stateChanges) balance(address HashBlock) Amount {
+	if balance, ok := c.balances[address]; ok {
+		return balance
+	}
+	return c.state.Balances[address]
+}
+
+func (c *stateChanges) nonce(address HashBlock) uint64 {
+	if nonce, ok := c.nonces[address]; ok {
+		return nonce
+	}
+	return c.state.Nonces[address]
+}
+
+func (c *stateChanges) contractCode(address HashBlock) []byte {
+	if code, ok := c.code[address]; ok {
+		return code
+	}
+	return c.state.Code[address]
+}
+
+func (c *stateChanges) load(contract HashBlock, key HashBlock) HashBlock {
+	if value, ok := c.storage[contract][key]; ok {
+		return value
+	}
+	return c.state.Storage[contract][key]
+}
+
+func (c *stateChanges) store(contract HashBlock, key HashBlock, value HashBlock) {
+	if c.storage[contract] == nil {
+		c.storage[contract] = make(map[HashBlock]HashBlock)
+	}
+	c.storage[contract][key] = value
+}
+
+func (c *stateChanges) credit(address HashBlock, ammount Amount) error {
+	balance, err := c.balance(address).Add(ammount)
+	if err != nil {
+		return err
+	}
+
+	c.balances[address] = balance
+	return nil
+}
+
+/* commit() writes the changes to the state and returns the values they replaced */
+func (s *LedgerState) commit(changes *stateChanges) (undo *StateUndo) {
+	undo = &StateUndo{
+		Height:    s.Height,
+		BlockHash: s.BlockHash,
+		Balances:  make(map[HashBlock]Amount),
+		Nonces:    make(map[HashBlock]uint64),
+		Code:      make(map[HashBlock][]byte),
+		Storage:   make(map[HashBlock]map[HashBlock]HashBlock),
+	}
+
+	for address, balance := range changes.balances {
+		undo.Balances[address] = s.Balances[address]
+		s.setBalance(address, balance)
+	}
+
+	for address, nonce := range changes.nonces {
+		undo.Nonces[address] = s.Nonces[address]
+		s.Nonces[address] = nonce
+	}
+
+	for address, code := range changes.code {
+		undo.Code[address] = s.Code[address]
+		s.setCode(address, code)
+	}
+
+	for contract, slots := range changes.storage {
+		undo.Storage[contract] = make(map[HashBlock]HashBlock)
+		for key, value := range slots {
+			undo.Storage[contract][key] = s.Storage[contract][key]
+			s.setSlot(contract, key, value)
+		}
+	}
+
+	return undo
+}
+
+/* Undo() returns the state to the point before the block of the undo data was applied */
+func (s *LedgerState) Undo(undo *StateUndo) {
+	for address, balance := range undo.Balances {
+		s.setBalance(address, balance)
+	}
+
+	for address, nonce := range undo.Nonces {
+		if nonce == 0 {
+			delete(s.Nonces, address)
+		} else {
+			s.Nonces[address] = nonce
+		}
+	}
+
+	for address, code := range undo.Code {
+		s.setCode(address, code)
+	}
+
+	for contract, slots := range undo.Storage {
+		for key, value := range slots {
+			s.setSlot(contract, key, value)
+		}
+	}
+
+	s.Height = undo.Height
+	s.BlockHash = undo.BlockHash
+}
+
+func (s *LedgerState) setBalance(address HashBlock, balance Amount) {
+	if balance == 0 {
+		delete(s.Balances, address)
+	} else {
+		s.Balances[address] = balance
+	}
+}
+
+func (s *LedgerState) setCode(address HashBlock, code []byte) {
+	if code == nil {
+		delete(s.Code, address)
+	} else {
+		s.Code[address] = code
+	}
+}
+
+func (s *LedgerState) setSlot(contract HashBlock, key HashBlock, value HashBlock) {
+	empty := HashBlock{}
+	if value.Equal(&empty) {
+		delete(s.Storage[contract], key)
+		if len(s.Storage[contract]) == 0 {
+			delete(s.Storage, contract)
+		}
+		return
+	}
+
+	if s.Storage[contract] == nil {
+		s.Storage[contract] = make(map[HashBlock]HashBlock)
+	}
+	s.Storage[contract][key] = value
+}
+
+func (s *LedgerState) Checkpoint() (result *StateCheckpoint) {
+	result = &StateCheckpoint{
+		Height:    s.Height,
+		BlockHash: s.BlockHash,
+		Entries:   make([]StateEntry, 0),
+	}
+
+	entries := make(map[HashBlock]*StateEntry)
+	entryOf := func(address HashBlock) *StateEntry {
+		if entries[address] == nil {
+			entries[address] = &StateEntry{Address: address}
+		}
+		return entries[address]
+	}
+
+	for address, balance := range s.Balances {
+		entryOf(address).Balance = balance
+	}
+
+	for address, nonce := range s.Nonces {
+		entryOf(address).Nonce = nonce
+	}
+
+	for address, code := range s.Code {
+		entryOf(address).Code = code
+	}
+
+	for contract, slots := range s.Storage {
+		entry := entryOf(contract)
+		for key, value := range slots {
+			entry.Storage = append(entry.Storage, StorageSlot{Key: key, Value: value})
+		}
+	}
+
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, *entry)
+	}
+
+	return result
+}
+
+func (c *StateCheckpoint) State() (result *LedgerState) {
+	result = NewLedgerState()
+	result.Height = c.Height
+	result.BlockHash = c.BlockHash
+
+	for _, entry := range c.Entries {
+		result.setBalance(entry.Address, entry.Balance)
+		if entry.Nonce > 0 {
+			result.Nonces[entry.Address] = entry.Nonce
+		}
+
+		if len(entry.Code) > 0 {
+			result.setCode(entry.Address, entry.Code)
+		}
+
+		for _, slot := range entry.Storage {
+			result.setSlot(entry.Address, slot.Key, slot.Value)
+		}
+	}
+
+	return result
+}
+
+func saveStateCheckpoint(checkpoint *StateCheckpoint) (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.StateFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return db.Write(data)
+}
+
+func loadStateCheckpoints() (result []StateCheckpoint) {
+	db := &database.DatabaseFile{}
+	err := db.Open(database.StateFileName)
+	defer db.Close()
+
+	result = make([]StateCheckpoint, 0)
+	if err != nil {
+		return result
+	}
+
+	db.ForEach(func(data []byte) {
+		checkpoint := StateCheckpoint{}
+		if json.Unmarshal(data, &checkpoint) == nil {
+			result = append(result, checkpoint)
+		}
+	})
+
+	return result
+}
+
+/* ClearStateCheckpoints() removes the snapshots, so the next load replays the blocks from the genesis */
+func ClearStateCheckpoints() (err error) {
+	db := &database.DatabaseFile{}
+	err = db.Open(database.StateFileName)
+	if err != nil && !errors.Is(err, database.ErrEmpty) {
+		return err
+	}
+	defer db.Close()
+
+	return db.Clear()
+}
+
+/* rebuildState() restores the last checkpoint within the first "count" blocks and replays the others, saving their receipts when asked. Needs the mutex locked */
+func (b *Blockchain) rebuildState(count uint64, receipts bool) {
+	b.state = NewLedgerState()
+	b.undo = make([]*StateUndo, 0)
+
+	var restored *StateCheckpoint
+	checkpoints := loadStateCheckpoints()
+	for i := range checkpoints {
+		checkpoint := &checkpoints[i]
+		if checkpoint.Height == 0 || checkpoint.Height > count || (restored != nil && checkpoint.Height <= restored.Height) {
+			continue
+		}
+
+		if checkpoint.BlockHash.Equal(&b.Blocks[checkpoint.Height-1].Hash) {
+			restored = checkpoint
+		}
+	}
+
+	// The block hash only tells which block the snapshot follows, its balances must also match the state root of that block
+	if restored != nil {
+		state := restored.State()
+		stateRoot := NewStateTree(state).Root()
+
+		if stateRoot.Equal(&b.Blocks[restored.Height-1].StateRoot) {
+			b.state = state
+		} else {
+			log.Printf("The state checkpoint of block %d does not match its state root, replaying the blocks from the genesis\r\n", b.Blocks[restored.Height-1].Id)
+		}
+	}
+
+	for i := b.state.Height; i < count; i++ {
+		if b.Blocks[i].IsPruned() {
+			log.Panicf("Block %d cannot be applied to the ledger state: %s\r\n", b.Blocks[i].Id, ErrBlockPruned.Error())
+		}
+
+		undo, applied, err := b.state.Apply(&b.Blocks[i])
+		if err != nil {
+			log.Panicf("Block %d cannot be applied to the ledger state: %s\r\n", b.Blocks[i].Id, err.Error())
+		}
+
+		if receipts {
+			if err = saveReceipts(&b.Blocks[i], applied); err != nil {
+				log.Printf("Error saving the receipts of block %d: %s\r\n", b.Blocks[i].Id, err.Error())
+			}
+		}
+
+		b.undo = append(b.undo, undo)
+		b.checkpointState()
+	}
+}
+
+/* checkpointState() saves a snapshot of the state every StateCheckpointInterval blocks */
+func (b *Blockchain) checkpointState() {
+	interval := Params().StateCheckpointInterval
+	if interval == 0 || b.state.Height%interval != 0 {
+		return
+	}
+
+	if err := saveStateCheckpoint(b.state.Checkpoint()); err != nil {
+		log.Printf("Error saving the state checkpoint: %s\r\n", err.Error())
+	}
+}
+
+/* loadState() must be called with the blockchain mutex locked */
+func (b *Blockchain) loadState() *LedgerState {
+	b.checkAndLoadBlocks()
+
+	if b.state == nil {
+		b.rebuildState(uint64(len(b.Blocks)), false)
+	}
+
+	return b.state
+}
+
+func (b *Blockchain) Balance(address *HashBlock) Amount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.loadState().Balance(address)
+}
+
+/* RebuildState() discards the checkpoints and replays every block from the genesis */
+func (b *Blockchain) RebuildState() (result *LedgerState, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkAndLoadBlocks()
+	if b.prunedHeight() > 0 {
+		return nil, ErrBlockPruned
+	}
+
+	err = ClearStateCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ClearReceipts()
+	if err != nil {
+		return nil, err
+	}
+
+	b.checkAndLoadBlocks()
+	b.rebuildState(uint64(len(b.Blocks)), true)
+
+	return b.state, nil
+}
+
+/* connectBlock() applies the block to the state and appends it to the chain. Needs the mutex locked */
+func (b *Blockchain) connectBlock(block *Block) error {
+	state := b.loadState()
+
+	undo, receipts, err := state.Apply(block)
+	if err != nil {
+		return err
+	}
+
+	stateRoot := NewStateTree(state).Root()
+	if !stateRoot.Equal(&block.StateRoot) {
+		state.Undo(undo)
+		return ErrInvalidStateRoot
+	}
+
+	receiptsRoot := ReceiptsRoot(receipts)
+	if !receiptsRoot.Equal(&block.ReceiptsRoot) {
+		state.Undo(undo)
+		return ErrInvalidReceiptsRoot
+	}
+
+	b.Blocks = append(b.Blocks, *block)
+	b.undo = append(b.undo, undo)
+
+	err = b.Persist(false)
+	if err != nil {
+		return err
+	}
+
+	b.checkpointState()
+
+	if err = saveReceipts(block, receipts); err != nil {
+		log.Printf("Error saving the receipts of block %d: %s\r\n", block.Id, err.Error())
+	}
+
+	return nil
+}
+
+/* DisconnectTip() removes the last block of the chain and rolls the state back to its parent */
+func (b *Blockchain) DisconnectTip() (result *Block, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.disconnectTip()
+}
+
+/* disconnectTip() must be called with the blockchain mutex locked */
+func (b *Blockchain) disconnectTip() (result *Block, err error) {
+	b.loadState()
+
+	if len(b.Blocks) <= 1 {
+		return nil, ErrDisconnectGenesis
+	}
+
+	tip := b.Blocks[len(b.Blocks)-1]
+	if b.belowCheckpoint(tip.Id) {
+		return nil, ErrBelowCheckpoint
+	}
+
+	dat := database.BlockDB{}
+	if err = dat.Open(); err != nil {
+		return nil, err
+	}
+	defer dat.Close()
+
+	if err = dat.RemoveLast(); err != nil {
+		return nil, err
+	}
+
+	b.Blocks = b.Blocks[:len(b.Blocks)-1]
+
+	if len(b.undo) > 0 {
+		b.state.Undo(b.undo[len(b.undo)-1])
+		b.undo = b.undo[:len(b.undo)-1]
+	} else {
+		b.rebuildState(uint64(len(b.Blocks)), false)
+	}
+
+	return &tip, nil
+}
@@ -0,0 +1,241 @@
+package blockchain
+
+import (
+	"engine/utils"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const StateTreeDepth = 256
+
+type (
+	/* Sparse merkle tree of the ledger state with one leaf per possible address */
+	StateTree struct {
+		leaves map[HashBlock]HashBlock
+		keys   []HashBlock
+	}
+
+	/* Proof of the balance and nonce of an address in the state committed by a block header */
+	BalanceProof struct {
+		BlockId  uint64      `json:"block_id"`
+		Address  HashBlock   `json:"address"`
+		Balance  Amount      `json:"balance"`
+		Nonce    uint64      `json:"nonce"`
+		Contract *HashBlock  `json:"contract,omitempty"` // Hash of the code and storage when the address is a contract
+		Bitmap   HashBlock   `json:"bitmap"`             // Bit set for each depth whose sibling is not an empty subtree
+		Siblings []HashBlock `json:"siblings"`           // Hashes of the non empty siblings, from the root to the leaf
+	}
+)
+
+func NewStateTree(state *LedgerState) (result *StateTree) {
+	result = &StateTree{leaves: make(map[HashBlock]HashBlock)}
+
+	for address, balance := range state.Balances {
+		result.leaves[address] = stateLeafHash(&address, balance, state.Nonces[address], nil)
+	}
+
+	for address, nonce := range state.Nonces {
+		result.leaves[address] = stateLeafHash(&address, state.Balances[address], nonce, nil)
+	}
+
+	for address := range state.Code {
+		contract := state.ContractHash(&address)
+		result.leaves[address] = stateLeafHash(&address, state.Balances[address], state.Nonces[address], &contract)
+	}
+
+	result.keys = make([]HashBlock, 0, len(result.leaves))
+	for address := range result.leaves {
+		result.keys = append(result.keys, address)
+	}
+
+	sort.Slice(result.keys, func(i, j int) bool {
+		return result.keys[i].Compare(&result.keys[j]) < 0
+	})
+
+	return result
+}
+
+/* Empty accounts have the same hash as an empty leaf, so a proof of them is a proof of absence. Contracts add the hash of their code and storage */
+func stateLeafHash(address *HashBlock, balance Amount, nonce uint64, contract *HashBlock) (result HashBlock) {
+	if balance == 0 && nonce == 0 && contract == nil {
+		return result
+	}
+
+	hash := sha3.New256()
+	hash.Write(address[:])
+	hash.Write(utils.Uint64ToBytes(uint64(balance)))
+	hash.Write(utils.Uint64ToBytes(nonce))
+	if contract != nil {
+		hash.Write(contract[:])
+	}
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* ContractHash() commits to the code of the contract and its storage slots in key order */
+func (s *LedgerState) ContractHash(address *HashBlock) (result HashBlock) {
+	slots := s.Storage[*address]
+	keys := make([]HashBlock, 0, len(slots))
+	for key := range slots {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Compare(&keys[j]) < 0
+	})
+
+	code := sha3.Sum256(s.Code[*address])
+	hash := sha3.New256()
+	hash.Write(code[:])
+	for _, key := range keys {
+		value := slots[key]
+		hash.Write(key[:])
+		hash.Write(value[:])
+	}
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* The hash of an empty subtree is zero at every depth */
+func stateNodeHash(left *HashBlock, right *HashBlock) (result HashBlock) {
+	empty := HashBlock{}
+	if left.Equal(&empty) && right.Equal(&empty) {
+		return result
+	}
+
+	hash := sha3.New256()
+	hash.Write(left[:])
+	hash.Write(right[:])
+	result.SetBytes(hash.Sum(nil))
+
+	return result
+}
+
+/* Bit of the address that selects the right (1) or left (0) child at the depth */
+func addressBit(address *HashBlock, depth int) byte {
+	return (address[depth/8] >> (7 - depth%8)) & 1
+}
+
+/* Keys are sorted, so the ones going to the right child are at the end */
+func splitKeys(keys []HashBlock, depth int) ([]HashBlock, []HashBlock) {
+	split := sort.Search(len(keys), func(i int) bool {
+		return addressBit(&keys[i], depth) == 1
+	})
+
+	return keys[:split], keys[split:]
+}
+
+func (t *StateTree) subtreeHash(keys []HashBlock, depth int) (result HashBlock) {
+	if len(keys) == 0 {
+		return result
+	}
+
+	if depth == StateTreeDepth {
+		return t.leaves[keys[0]]
+	}
+
+	left, right := splitKeys(keys, depth)
+	leftHash := t.subtreeHash(left, depth+1)
+	rightHash := t.subtreeHash(right, depth+1)
+
+	return stateNodeHash(&leftHash, &rightHash)
+}
+
+func (t *StateTree) Root() HashBlock {
+	return t.subtreeHash(t.keys, 0)
+}
+
+/* Proof() collects the sibling hashes along the path of the address */
+func (t *StateTree) Proof(address *HashBlock) (bitmap HashBlock, siblings []HashBlock) {
+	siblings = make([]HashBlock, 0)
+	keys := t.keys
+
+	for depth := 0; depth < StateTreeDepth; depth++ {
+		left, right := splitKeys(keys, depth)
+
+		sibling := left
+		keys = right
+		if addressBit(address, depth) == 0 {
+			sibling = right
+			keys = left
+		}
+
+		if len(sibling) > 0 {
+			bitmap[depth/8] |= 1 << (7 - depth%8)
+			siblings = append(siblings, t.subtreeHash(sibling, depth+1))
+		}
+	}
+
+	return bitmap, siblings
+}
+
+/* Verify() recomputes the state root from the leaf of the address and compares it with root */
+func (p *BalanceProof) Verify(root *HashBlock) bool {
+	current := stateLeafHash(&p.Address, p.Balance, p.Nonce, p.Contract)
+	next := len(p.Siblings) - 1
+
+	for depth := StateTreeDepth - 1; depth >= 0; depth-- {
+		sibling := HashBlock{}
+		if addressBit(&p.Bitmap, depth) == 1 {
+			if next < 0 {
+				return false
+			}
+			sibling = p.Siblings[next]
+			next--
+		}
+
+		if addressBit(&p.Address, depth) == 0 {
+			current = stateNodeHash(&current, &sibling)
+		} else {
+			current = stateNodeHash(&sibling, &current)
+		}
+	}
+
+	return next == -1 && current.Equal(root)
+}
+
+/* stateRootAfter() is the state root and the receipts root resulting from applying the block to the tip of the chain */
+func (b *Blockchain) stateRootAfter(block *Block) (result HashBlock, receiptsRoot HashBlock, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := b.loadState()
+
+	undo, receipts, err := state.Apply(block)
+	if err != nil {
+		return result, receiptsRoot, err
+	}
+
+	result = NewStateTree(state).Root()
+	receiptsRoot = ReceiptsRoot(receipts)
+	state.Undo(undo)
+
+	return result, receiptsRoot, nil
+}
+
+/* BalanceProof() proves the balance of the address in the state committed by the last block */
+func (b *Blockchain) BalanceProof(address *HashBlock) (result *BalanceProof, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := b.loadState()
+
+	result = &BalanceProof{
+		BlockId: b.Blocks[len(b.Blocks)-1].Id,
+		Address: *address,
+		Balance: state.Balance(address),
+		Nonce:   state.Nonce(address),
+	}
+
+	if _, ok := state.Code[*address]; ok {
+		contract := state.ContractHash(address)
+		result.Contract = &contract
+	}
+
+	result.Bitmap, result.Siblings = NewStateTree(state).Proof(address)
+
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	MaxTimeOffset  = 70 * 60 // Seconds a peer clock can differ from ours before it is ignored
+	MinTimeSamples = 5       // Peers needed before their clocks adjust ours
+	MaxTimeSamples = 200
+)
+
+/* Clock offsets of the connected peers by IP, learned from their welcome messages */
+type networkClock struct {
+	mutex   sync.Mutex
+	offsets map[string]int64
+}
+
+var clock = &networkClock{offsets: make(map[string]int64)}
+
+/* AddTimeSample() records the difference between the clock of a peer and ours. A host is sampled once, further samples are ignored */
+func AddTimeSample(peer string, peerTime uint64) bool {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	offset := int64(peerTime) - time.Now().Unix()
+	if offset < -MaxTimeOffset || offset > MaxTimeOffset {
+		return false
+	}
+
+	if _, exists := clock.offsets[peer]; exists || len(clock.offsets) >= MaxTimeSamples {
+		return false
+	}
+
+	clock.offsets[peer] = offset
+	return true
+}
+
+func RemoveTimeSample(peer string) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	delete(clock.offsets, peer)
+}
+
+/* peerHost() is the IP of a peer, so a host counts once whatever the number of its connections */
+func peerHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+/* TimeOffset() is the median of the peer clock offsets, zero until enough peers are known */
+func TimeOffset() int64 {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	if len(clock.offsets) < MinTimeSamples {
+		return 0
+	}
+
+	offsets := make([]int64, 0, len(clock.offsets)+1)
+	offsets = append(offsets, 0)
+	for _, offset := range clock.offsets {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	return offsets[len(offsets)/2]
+}
+
+/* AdjustedTime() is the local unix time corrected by the clocks of the peers */
+func AdjustedTime() uint64 {
+	return uint64(time.Now().Unix() + TimeOffset())
+}
+
+/* MedianTimePast() is the median time of the block and its ancestors, up to MedianTimeBlocks of them */
+func (n *BlockNode) MedianTimePast() uint64 {
+	times := make([]uint64, 0, Params().MedianTimeBlocks)
+	for node := n; node != nil && len(times) < Params().MedianTimeBlocks; node = node.Parent {
+		times = append(times, node.Block.Time)
+	}
+
+	return medianTime(times)
+}
+
+func medianTime(times []uint64) uint64 {
+	if len(times) == 0 {
+		return 0
+	}
+
+	sorted := append([]uint64{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[len(sorted)/2]
+}
+
+/* CheckTimestamp() verifies the block time is after the median time past of its parent and not too far in the future */
+func (b *Block) CheckTimestamp(medianTimePast uint64, now uint64) error {
+	if b.Time <= medianTimePast {
+		return ErrBlockTimeTooOld
+	}
+
+	if b.Time > now+Params().MaxFutureDrift {
+		return ErrBlockTimeTooNew
+	}
+
+	return nil
+}
+
+/* MedianTimePast() of the last block, the time the next block has to exceed */
+func (b *Blockchain) MedianTimePast() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.loadIndex()
+
+	return b.tipNode().MedianTimePast()
+}
@@ -1,9 +1,6 @@
 package blockchain
 
 import (
-	"bytes"
-	"encoding/binary"
-	"engine/database"
 	"engine/utils"
 	"errors"
 	"time"
@@ -11,13 +8,41 @@ import (
 	"golang.org/x/crypto/sha3"
 )
 
+/* Flags of the optional transaction fields written in the hash */
+const (
+	txHasLockTime byte = 1 << iota
+	txHasGasLimit
+	txHasData
+)
+
 type Transaction struct {
-	ID         HashBlock `json:"id"`          // Random hash created as the transaction ID.
-	From       HashBlock `json:"from"`        // Account address "from"
-	To         HashBlock `json:"to"`          // Account address "to"
-	CreateTime uint64    `json:"create_time"` // Time when this transaction was created
-	Ammount    float64   `json:"ammount"`     // Amount of the value being transferred
-	Hash       HashBlock `json:"hash"`        // Hash of all the fields above
+	ID         HashBlock `json:"id"`                  // Random hash created as the transaction ID.
+	From       HashBlock `json:"from"`                // Account address "from"
+	To         HashBlock `json:"to"`                  // Account address "to"
+	CreateTime uint64    `json:"create_time"`         // Time when this transaction was created
+	Ammount    Amount    `json:"ammount"`             // Amount of the value being transferred
+	Fee        Amount    `json:"fee"`                 // Fee paid to the miner that includes the transaction
+	Nonce      uint64    `json:"nonce"`               // Sequence number of the transaction among the ones sent by "from"
+	LockTime   uint64    `json:"lock_time"`           // Block height, or Unix time when >= LockTimeThreshold, before which the transaction cannot be included. Zero when not locked
+	GasLimit   uint64    `json:"gas_limit,omitempty"` // Gas the contract code can use. Zero for transfers that run no code
+	Data       []byte    `json:"data,omitempty"`      // Code of a deployment, or input of a contract call
+	Hash       HashBlock `json:"hash"`                // Hash of all the fields above
+	PublicKey  []byte    `json:"public_key"`          // Public key of the account "from". Its hash must be the address "from"
+	Signature  []byte    `json:"signature"`           // Signature of the hash by the private key of the account "from"
+}
+
+/* optionalFields() returns the flags of the optional fields set in the transaction */
+func (t *Transaction) optionalFields() (result byte) {
+	if t.LockTime > 0 {
+		result |= txHasLockTime
+	}
+	if t.GasLimit > 0 {
+		result |= txHasGasLimit
+	}
+	if len(t.Data) > 0 {
+		result |= txHasData
+	}
+	return result
 }
 
 func (t *Transaction) GetHash() (result *HashBlock) {
@@ -26,7 +51,23 @@ func (t *Transaction) GetHash() (result *HashBlock) {
 	hash.Write(t.From[:])
 	hash.Write(t.To[:])
 	hash.Write(utils.Uint64ToBytes(t.CreateTime))
-	hash.Write(utils.Float64ToBytes(t.Ammount))
+	hash.Write(utils.Uint64ToBytes(uint64(t.Ammount)))
+	hash.Write(utils.Uint64ToBytes(uint64(t.Fee)))
+	hash.Write(utils.Uint64ToBytes(t.Nonce))
+	// The flags say which optional fields follow. Transactions without any keep the hashes they had before the fields existed
+	if flags := t.optionalFields(); flags != 0 {
+		hash.Write([]byte{flags})
+		if flags&txHasLockTime != 0 {
+			hash.Write(utils.Uint64ToBytes(t.LockTime))
+		}
+		if flags&txHasGasLimit != 0 {
+			hash.Write(utils.Uint64ToBytes(t.GasLimit))
+		}
+		if flags&txHasData != 0 {
+			hash.Write(utils.Uint64ToBytes(uint64(len(t.Data))))
+			hash.Write(t.Data)
+		}
+	}
 	digest := hash.Sum(nil)
 	result = &HashBlock{}
 	copy(result[:], digest)
@@ -40,8 +81,8 @@ func (t *Transaction) ToHashString() (result string) {
 	return result
 }
 
-/* Create new transaction */
-func (a *Transaction) NewTransaction(from, to string, ammount float64) (result *Transaction, err error) {
+/* Create new transaction. The sender must be a local account, the receiver can be any valid address */
+func (b *Blockchain) NewTransaction(from, to string, ammount Amount, fee Amount, lockTime uint64) (result *Transaction, err error) {
 	account := Account{}
 
 	accountFrom, err := account.GetAccount(from)
@@ -49,48 +90,99 @@ func (a *Transaction) NewTransaction(from, to string, ammount float64) (result *
 		return nil, err
 	}
 
-	accountTo, err := account.GetAccount(to)
+	if accountFrom.KeyType() == KeyTypeMultisig {
+		return nil, ErrMultisigAccount
+	}
+
+	result, err = newTransfer(b, accountFrom, to, ammount, fee, lockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Signature, err = account.SignWithPrivateKey(result.Hash[:], from)
 	if err != nil {
 		return nil, err
 	}
 
-	if accountFrom.Equals(accountTo) {
+	err = (&Mempool{}).Add(result, b.AccountNonce)
+
+	return result, err
+}
+
+/* newTransfer() creates the unsigned transaction of a transfer from a local account */
+func newTransfer(bc *Blockchain, accountFrom *Account, to string, ammount Amount, fee Amount, lockTime uint64) (result *Transaction, err error) {
+	addressTo, err := ParseAddress(to)
+	if err != nil {
+		return nil, err
+	}
+
+	if accountFrom.Address.Equal(&addressTo) {
 		return nil, errors.New("attempting to transfer to the same account (from = to)")
 	}
 
-	if accountFrom.Balance < ammount {
+	if ammount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	return newTransaction(bc, accountFrom, &Transaction{To: addressTo, Ammount: ammount, Fee: fee, LockTime: lockTime})
+}
+
+/* newTransaction() checks the local account can pay the transaction and fills its sender, ID, nonce, hash and public key */
+func newTransaction(bc *Blockchain, accountFrom *Account, result *Transaction) (*Transaction, error) {
+	if result.Fee < 0 {
+		return nil, ErrFeeTooLow
+	}
+
+	total, err := result.Ammount.Add(result.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	if bc.Balance(&accountFrom.Address) < total {
 		return nil, ErrInsufficientFunds
 	}
 
-	result = &Transaction{
-		ID:         utils.NewRandomHash(),
-		From:       accountFrom.Address,
-		To:         accountTo.Address,
-		CreateTime: uint64(time.Now().Unix()),
-		Ammount:    ammount,
+	if bc.SpendableBalance(&accountFrom.Address) < total {
+		return nil, ErrImmatureFunds
 	}
 
+	result.ID = utils.NewRandomHash()
+	result.From = accountFrom.Address
+	result.CreateTime = uint64(time.Now().Unix())
+
+	accountNonce := bc.AccountNonce(&accountFrom.Address)
+	result.Nonce = (&Mempool{}).NextNonce(&accountFrom.Address, accountNonce)
+
 	hash := result.GetHash()
 	result.Hash.Set(hash)
+	result.PublicKey = accountFrom.PublicKey
 
-	err = result.Persist()
-
-	return result, err
+	return result, nil
 }
 
-func (a *Transaction) Persist() (err error) {
+/* VerifySignature() checks the transaction was signed by the key whose hash is the sender address. The key and the signature are outside the hash and the merkle leaves, so they must have a single valid encoding: the address binds the key and verifySignature() the signature */
+func (t *Transaction) VerifySignature() error {
+	// The merkle root is built from the stored hashes, so the coinbase must match its hash too
+	if !t.Hash.Equal(t.GetHash()) {
+		return ErrInvalidTransactionHash
+	}
+
+	if t.IsCoinbase() {
+		return nil
+	}
 
-	db := &database.DatabaseFile{}
-	err = db.Open(database.AccountsFileName)
-	if err != nil {
-		return err
+	if len(t.Signature) == 0 {
+		return ErrUnsignedTransaction
 	}
-	defer db.Close()
 
-	buff := &bytes.Buffer{}
-	binary.Write(buff, binary.LittleEndian, *a)
+	address := AddressFromPublicKey(t.PublicKey)
+	if len(t.PublicKey) == 0 || !address.Equal(&t.From) {
+		return ErrInvalidPublicKey
+	}
 
-	db.Write(buff.Bytes())
+	if verifySignature(t.PublicKey, t.Hash[:], t.Signature) != nil {
+		return ErrInvalidSignature
+	}
 
-	return err
+	return nil
 }
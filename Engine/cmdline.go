@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"engine/blockchain"
+	"engine/vm"
 	"engine/webserver"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type (
@@ -47,23 +54,30 @@ func buildCommandList() {
 			Parameters:  map[string]*Parameter{},
 		},
 
-		"airdrop": {
-			Description: []string{"Blockchain deposit \"ammount\" of coins into the \"to\" account"},
-			Func:        doAirdrop,
+		"init": {
+			Description: []string{"Create the genesis block from a template, so all nodes of a network share the same genesis"},
+			Func:        doInit,
 			Parameters: map[string]*Parameter{
-				"to":      {Required: true, Description: "Destination of the ammount to be credited"},
-				"ammount": {Required: true, Description: "the ammount to be transferred. Must be > 0 and <= 10000"},
+				"genesis": {Required: false, Description: "The json file with the genesis template. Default is the " + blockchain.GenesisTemplateFileName + " of the network data directory"},
 			},
 		},
 		"send": {
 			Description: []string{"Transfer coins from an account to a destination account."},
 			Func:        doSend,
 			Parameters: map[string]*Parameter{
-				"from":    {Required: true, Description: "The account to be debited"},
-				"to":      {Required: true, Description: "The account to be credited"},
-				"ammount": {Required: true, Description: "The ammount to transfer. Must be > 0 and <= 10000"},
+				"from":       {Required: true, Description: "The account to be debited"},
+				"to":         {Required: true, Description: "The account to be credited"},
+				"ammount":    {Required: true, Description: "The ammount to transfer. Must be > 0 and <= 10000"},
+				"fee":        {Required: false, Description: "The fee paid to the miner. Default is the fee suggested by \"estimatefee\""},
+				"passphrase": {Required: false, Description: "The passphrase of the account to be debited. Asked when not informed"},
+				"after":      {Required: false, Description: "Lock the transfer until a block height, a Unix time or a date like 2026-01-01T00:00:00Z. The mempool holds it until then, with the later transfers of the account"},
 			},
 		},
+		"estimatefee": {
+			Description: []string{"Suggest a transaction fee from the fees paid in the recent blocks"},
+			Func:        doEstimateFee,
+			Parameters:  map[string]*Parameter{},
+		},
 		"startminer": {
 			Description: []string{"Start the blockchain miner engine."},
 			Func:        doStartMiner,
@@ -72,6 +86,26 @@ func buildCommandList() {
 				"benchmark": {Required: false, Description: "Start miner on benchmark mode. Value must be 'yes' or 'no'"},
 			},
 		},
+		"generate": {
+			Description: []string{"Mine the given number of blocks and stop, mostly to create blocks instantly on the regtest network"},
+			Func:        doGenerate,
+			Parameters: map[string]*Parameter{
+				"blocks":  {Required: true, Description: "Number of blocks to mine"},
+				"address": {Required: false, Description: "The account receiving the block rewards. Default is the wallet of the miner configuration"},
+			},
+		},
+		"rebuildstate": {
+			Description: []string{"Discard the ledger state checkpoints and rebuild the balances replaying every block from the genesis"},
+			Func:        doRebuildState,
+			Parameters:  map[string]*Parameter{},
+		},
+		"submitblock": {
+			Description: []string{"Add a block saved in a json file to the block tree, reorganising the chain when its branch has more work"},
+			Func:        doSubmitBlock,
+			Parameters: map[string]*Parameter{
+				"block": {Required: true, Description: "The json file with the block"},
+			},
+		},
 		"accounts": {
 			Description: []string{"Display all accounts registered in the blockchain"},
 			Func:        doAccounts,
@@ -80,74 +114,1112 @@ func buildCommandList() {
 			},
 		},
 		"newaccount": {
-			Description: []string{"Create a new account with a random number identified by a label"},
+			Description: []string{"Derive the next account of the HD wallet, identified by a label. The first call creates the wallet and displays its recovery mnemonic"},
 			Func:        doNewAccount,
 			Parameters: map[string]*Parameter{
-				"label": {Required: true, Description: "The label to identify the new account"},
+				"label":      {Required: true, Description: "The label to identify the new account"},
+				"passphrase": {Required: false, Description: "The passphrase protecting the private key in the keystore. Asked when not informed"},
+			},
+		},
+		"restorewallet": {
+			Description: []string{"Recreate the HD wallet from its recovery mnemonic and restore the accounts used in the blockchain"},
+			Func:        doRestoreWallet,
+			Parameters: map[string]*Parameter{
+				"mnemonic":   {Required: false, Description: "The recovery mnemonic words between quotes. Asked when not informed"},
+				"passphrase": {Required: false, Description: "The passphrase protecting the wallet and the private keys in the keystore. Asked when not informed"},
+			},
+		},
+		"publickey": {
+			Description: []string{"Display the public key of an account, to inform it to the creator of a multisig account"},
+			Func:        doPublicKey,
+			Parameters: map[string]*Parameter{
+				"address": {Required: true, Description: "The bech32 account address, like hsn1..."},
+			},
+		},
+		"createmultisig": {
+			Description: []string{"Register an m-of-n multisig account, whose transfers need the signatures of the threshold number of signers"},
+			Func:        doCreateMultisig,
+			Parameters: map[string]*Parameter{
+				"label":     {Required: true, Description: "The label to identify the multisig account"},
+				"threshold": {Required: true, Description: "The number of signatures required to send a transfer"},
+				"keys":      {Required: true, Description: "Comma separated signers. Each one is the address of a local account or a public key displayed by \"publickey\""},
+			},
+		},
+		"createpartial": {
+			Description: []string{"Create a partially signed transfer from a multisig account, saved in a json file to collect the signatures"},
+			Func:        doCreatePartial,
+			Parameters: map[string]*Parameter{
+				"from":    {Required: true, Description: "The multisig account to be debited"},
+				"to":      {Required: true, Description: "The account to be credited"},
+				"ammount": {Required: true, Description: "The ammount to transfer"},
+				"fee":     {Required: false, Description: "The fee paid to the miner. Default is the fee suggested for the threshold number of signatures"},
+				"tx":      {Required: true, Description: "The json file to save the partially signed transaction"},
+				"after":   {Required: false, Description: "Lock the transfer until a block height, a Unix time or a date like 2026-01-01T00:00:00Z"},
+			},
+		},
+		"signpartial": {
+			Description: []string{"Add the signature of a local signer account to a partially signed transaction"},
+			Func:        doSignPartial,
+			Parameters: map[string]*Parameter{
+				"tx":         {Required: true, Description: "The json file with the partially signed transaction"},
+				"address":    {Required: true, Description: "The signer account"},
+				"passphrase": {Required: false, Description: "The passphrase of the signer account. Asked when not informed"},
+			},
+		},
+		"broadcast": {
+			Description: []string{"Send a partially signed transaction to the mempool once it has the signatures required by the threshold"},
+			Func:        doBroadcast,
+			Parameters: map[string]*Parameter{
+				"tx": {Required: true, Description: "The json file with the partially signed transaction"},
+			},
+		},
+		"htlclock": {
+			Description: []string{"Lock coins in a hash time-locked contract. The recipient claims them revealing the preimage of the hash before the deadline, the sender is refunded after it"},
+			Func:        doHTLCLock,
+			Parameters: map[string]*Parameter{
+				"from":       {Required: true, Description: "The local account locking the coins, refunded after the deadline"},
+				"to":         {Required: true, Description: "The account that can claim the coins"},
+				"ammount":    {Required: true, Description: "The ammount to lock"},
+				"deadline":   {Required: true, Description: "The block height, Unix time or date like 2026-01-01T00:00:00Z when the claim expires and the refund opens"},
+				"hash":       {Required: false, Description: "The SHA3-256 hash of the preimage in hex. Default is the hash of a new random preimage, which is displayed"},
+				"fee":        {Required: false, Description: "The fee paid to the miner. Default is the fee suggested by \"estimatefee\""},
+				"passphrase": {Required: false, Description: "The passphrase of the account locking the coins. Asked when not informed"},
+			},
+		},
+		"htlcclaim": {
+			Description: []string{"Claim the coins of a hash time-locked contract revealing the preimage, before the deadline"},
+			Func:        doHTLCClaim,
+			Parameters: map[string]*Parameter{
+				"contract":   {Required: true, Description: "The contract in hex displayed by \"htlclock\""},
+				"preimage":   {Required: true, Description: "The preimage of the hash in hex"},
+				"passphrase": {Required: false, Description: "The passphrase of the recipient account. Asked when not informed"},
+			},
+		},
+		"htlcrefund": {
+			Description: []string{"Take back the coins of a hash time-locked contract that was not claimed. The mempool holds the refund until the deadline"},
+			Func:        doHTLCRefund,
+			Parameters: map[string]*Parameter{
+				"contract":   {Required: true, Description: "The contract in hex displayed by \"htlclock\""},
+				"passphrase": {Required: false, Description: "The passphrase of the sender account. Asked when not informed"},
+			},
+		},
+		"htlcstatus": {
+			Description: []string{"Display the terms and the balance of a hash time-locked contract, and the preimage once it was claimed"},
+			Func:        doHTLCStatus,
+			Parameters: map[string]*Parameter{
+				"contract": {Required: true, Description: "The contract in hex displayed by \"htlclock\""},
+			},
+		},
+		"passphrase": {
+			Description: []string{"Change the passphrase protecting the private key of an account in the keystore"},
+			Func:        doPassphrase,
+			Parameters: map[string]*Parameter{
+				"address": {Required: true, Description: "The bech32 account address, like hsn1..."},
+				"old":     {Required: false, Description: "The current passphrase. Asked when not informed"},
+				"new":     {Required: false, Description: "The new passphrase. Asked when not informed"},
+			},
+		},
+		"compile": {
+			Description: []string{"Assemble a contract and display its bytecode and instructions"},
+			Func:        doCompile,
+			Parameters: map[string]*Parameter{
+				"source": {Required: true, Description: "The assembly file of the contract, like contracts/counter.asm"},
+			},
+		},
+		"runcontract": {
+			Description: []string{"Run a contract offline on an empty storage: its deployment and then each call, keeping the storage between them"},
+			Func:        doRunContract,
+			Parameters: map[string]*Parameter{
+				"code":   {Required: true, Description: "The assembly file of the contract or its bytecode in hex"},
+				"calls":  {Required: false, Description: "Inputs of the calls between quotes, separated by \";\". Each input is a list of comma separated words: numbers, hex values or addresses"},
+				"caller": {Required: false, Description: "The address of the sender of the deployment and the calls"},
+				"value":  {Required: false, Description: "The ammount sent with each call"},
+			},
+		},
+		"deploy": {
+			Description: []string{"Deploy a contract. Its code runs once with an empty input, and its address is displayed"},
+			Func:        doDeploy,
+			Parameters: map[string]*Parameter{
+				"from":       {Required: true, Description: "The account deploying the contract and paying the fee"},
+				"code":       {Required: true, Description: "The assembly file of the contract or its bytecode in hex"},
+				"ammount":    {Required: false, Description: "The ammount sent to the contract. Default is zero"},
+				"gas":        {Required: false, Description: "The gas limit of the deployment. Default is " + strconv.Itoa(blockchain.DefaultGasLimit)},
+				"fee":        {Required: false, Description: "The fee paid to the miner, which includes the gas limit at the gas price. Default is the suggested fee"},
+				"passphrase": {Required: false, Description: "The passphrase of the account. Asked when not informed"},
+			},
+		},
+		"call": {
+			Description: []string{"Send a transaction calling a contract. The outcome is recorded in its receipt"},
+			Func:        doCall,
+			Parameters: map[string]*Parameter{
+				"from":       {Required: true, Description: "The account calling the contract and paying the fee"},
+				"to":         {Required: true, Description: "The address of the contract"},
+				"input":      {Required: true, Description: "Comma separated words of the input: numbers, hex values or addresses"},
+				"ammount":    {Required: false, Description: "The ammount sent to the contract. Default is zero"},
+				"gas":        {Required: false, Description: "The gas limit of the call. Default is " + strconv.Itoa(blockchain.DefaultGasLimit)},
+				"fee":        {Required: false, Description: "The fee paid to the miner, which includes the gas limit at the gas price. Default is the suggested fee"},
+				"passphrase": {Required: false, Description: "The passphrase of the account. Asked when not informed"},
+			},
+		},
+		"querycontract": {
+			Description: []string{"Run a call of a contract on the current state without sending a transaction, and display its outcome"},
+			Func:        doQueryContract,
+			Parameters: map[string]*Parameter{
+				"to":    {Required: true, Description: "The address of the contract"},
+				"input": {Required: true, Description: "Comma separated words of the input: numbers, hex values or addresses"},
+				"from":  {Required: false, Description: "The address of the caller"},
+			},
+		},
+		"receipt": {
+			Description: []string{"Display the receipt of a transaction included in the blockchain: block, position, status, fee and logs"},
+			Func:        doReceipt,
+			Parameters: map[string]*Parameter{
+				"tx": {Required: true, Description: "The id of the transaction returned by the \"send\" command"},
 			},
 		},
 		"startnode": {
 			Description: []string{"Start the Node to synchronize the blockchain network with other nodes."},
 			Func:        doStartNode,
 			Parameters: map[string]*Parameter{
-				"port": {Required: false, Description: "Set the TCP/IP port number to the listener. Default is 8085"},
+				"port":  {Required: false, Description: "Set the TCP/IP port number to the listener. Default is the node port of the network (8085 on main)"},
+				"prune": {Required: false, Description: "Run as a pruned node keeping the transactions of this number of recent blocks. Default is the \"prune\" value of nodeconfig.json"},
+			},
+		},
+		"prune": {
+			Description: []string{"Drop the transactions of the old blocks, keeping their headers and the ledger state"},
+			Func:        doPrune,
+			Parameters: map[string]*Parameter{
+				"keep": {Required: true, Description: "Number of recent blocks whose transactions are kept"},
+			},
+		},
+		"checkpoints": {
+			Description: []string{"Display the checkpoints of the network, including the ones of " + blockchain.CheckpointsFileName + ", that every chain must match"},
+			Func:        doCheckpoints,
+			Parameters:  map[string]*Parameter{},
+		},
+		"lightwallet": {
+			Description: []string{"Download and validate only the block headers from a full node, and verify a payment with its merkle inclusion proof"},
+			Func:        doLightWallet,
+			Parameters: map[string]*Parameter{
+				"peer":  {Required: false, Description: "The full node as ip:port. Default is the local node on the node port of the network"},
+				"tx":    {Required: false, Description: "The id or hash of the transaction to verify"},
+				"block": {Required: false, Description: "The id of the block containing the transaction. Default is the block of its receipt in the full node"},
+			},
+		},
+		"orphans": {
+			Description: []string{"Display the number of orphan blocks held by a running node and the counters of its orphan pool"},
+			Func:        doOrphans,
+			Parameters: map[string]*Parameter{
+				"peer": {Required: false, Description: "The node as ip:port. Default is the local node on the node port of the network"},
+			},
+		},
+		"merkleproof": {
+			Description: []string{"Display the merkle inclusion proof of a transaction within a block"},
+			Func:        doMerkleProof,
+			Parameters: map[string]*Parameter{
+				"block": {Required: true, Description: "The id of the block containing the transaction"},
+				"tx":    {Required: true, Description: "The hash of the transaction"},
+			},
+		},
+		"verifyproof": {
+			Description: []string{"Verify a merkle inclusion proof saved in a json file"},
+			Func:        doVerifyProof,
+			Parameters: map[string]*Parameter{
+				"proof": {Required: true, Description: "The json file with the proof created by the \"merkleproof\" command"},
+				"root":  {Required: false, Description: "The merkle root to check against. Default is the merkle root of the block in the local blockchain"},
+			},
+		},
+		"balanceproof": {
+			Description: []string{"Display the proof of the balance of an account in the state of the last block"},
+			Func:        doBalanceProof,
+			Parameters: map[string]*Parameter{
+				"address": {Required: true, Description: "The bech32 account address, like hsn1..."},
+			},
+		},
+		"verifybalance": {
+			Description: []string{"Verify a balance proof saved in a json file"},
+			Func:        doVerifyBalance,
+			Parameters: map[string]*Parameter{
+				"proof": {Required: true, Description: "The json file with the proof created by the \"balanceproof\" command"},
+				"root":  {Required: false, Description: "The state root to check against. Default is the state root of the block in the local blockchain"},
 			},
 		},
 		"startws": {
-			Description: []string{"Start WebServer engine on port 8080"},
+			Description: []string{"Start WebServer engine on the web port of the network (8080 on main). The wallet routes listen on " + webserver.DefaultWalletHost + " and the wallet port (8081 on main)"},
 			Func:        doStartWS,
 			Parameters: map[string]*Parameter{
-				"port": {Required: false, Description: "Set the TCP/IP port number to the listener. Default is 8080"},
+				"port":       {Required: false, Description: "Set the TCP/IP port number to the listener. Default is the web port of the network"},
+				"walletport": {Required: false, Description: "Set the TCP/IP port number of the wallet routes, which need a token of \"/login\". Default is the wallet port of the network (8081 on main)"},
+				"wallethost": {Required: false, Description: "The interface of the wallet routes. Default is " + webserver.DefaultWalletHost + ", only reachable from this computer"},
 			},
 		},
 	}
 }
 
-func doStartWS(c *Command) {
-	ws := &webserver.WebServer{}
-	port := c.Parameters["port"].Value
+func doStartWS(c *Command) {
+	ws := &webserver.WebServer{}
+	port := c.Parameters["port"].Value
+
+	if len(port) > 0 {
+		numPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		ws.UsePort(int(numPort))
+	}
+
+	walletPort := int64(0)
+	if port := c.Parameters["walletport"].Value; len(port) > 0 {
+		var err error
+		walletPort, err = strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+	}
+	ws.UseWallet(c.Parameters["wallethost"].Value, int(walletPort))
+
+	started := make(chan bool)
+	go func(w *webserver.WebServer) {
+		w.Start(started)
+	}(ws)
+
+	if <-started {
+		log.Println("WebServer started!")
+	}
+}
+
+func doStartNode(c *Command) {
+	blockchainNode := &blockchain.BlockchainNode{}
+	port := c.Parameters["port"].Value
+
+	if len(port) > 0 {
+		numPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		blockchainNode.UsePort(int(numPort))
+	}
+
+	if prune := c.Parameters["prune"].Value; len(prune) > 0 {
+		keep, err := strconv.ParseUint(prune, 10, 64)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		blockchainNode.UsePruning(keep)
+	}
+
+	blockchainNode.StartListener()
+}
+
+func doCheckpoints(c *Command) {
+	checkpoints := blockchain.Checkpoints()
+	if len(checkpoints) == 0 {
+		fmt.Println("The network has no checkpoints.")
+		os.Exit(0)
+	}
+
+	heights := make([]uint64, 0, len(checkpoints))
+	for height := range checkpoints {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	bc := &blockchain.Blockchain{}
+	for _, height := range heights {
+		hash := checkpoints[height]
+		if len(bc.Headers(height, 1)) > 0 {
+			fmt.Printf("Block %d 0x%x reached\r\n", height, hash)
+		} else {
+			fmt.Printf("Block %d 0x%x not reached yet\r\n", height, hash)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func doLightWallet(c *Command) {
+	peer := c.Parameters["peer"].Value
+	if len(peer) == 0 {
+		peer = fmt.Sprintf("127.0.0.1:%d", blockchain.Net().NodePort)
+	}
+
+	client, err := blockchain.OpenLightClient()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	added, err := client.Sync(peer)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	tip := client.Tip()
+	fmt.Printf("Synchronized %d headers. Tip: block %d 0x%x\r\n", added, tip.Id, tip.Hash)
+
+	if len(c.Parameters["tx"].Value) == 0 {
+		os.Exit(0)
+	}
+
+	request := &blockchain.PaymentProofRequest{}
+	if err := request.Transaction.SetHexString(c.Parameters["tx"].Value); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	if block := c.Parameters["block"].Value; len(block) > 0 {
+		blockId, err := strconv.ParseUint(block, 10, 64)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		request.BlockId = &blockId
+	}
+
+	proof, err := client.FetchPaymentProof(peer, request)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	confirmations, err := client.VerifyPayment(proof)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	transaction := &proof.Transaction
+	fmt.Printf("Verified transaction 0x%x in block %d with %d confirmations.\r\n", transaction.Hash, proof.Proof.BlockId, confirmations)
+	fmt.Printf("  From: %s\r\n", blockchain.EncodeAddress(&transaction.From))
+	fmt.Printf("  To: %s\r\n", blockchain.EncodeAddress(&transaction.To))
+	fmt.Printf("  Ammount: %s Fee: %s\r\n", transaction.Ammount, transaction.Fee)
+
+	os.Exit(0)
+}
+
+func doOrphans(c *Command) {
+	peer := c.Parameters["peer"].Value
+	if len(peer) == 0 {
+		peer = fmt.Sprintf("127.0.0.1:%d", blockchain.Net().NodePort)
+	}
+
+	metrics, err := blockchain.FetchOrphanMetrics(peer)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Orphans in the pool: %d\r\n", metrics.Count)
+	fmt.Printf("Added: %d Connected: %d Evicted: %d Expired: %d\r\n", metrics.Added, metrics.Connected, metrics.Evicted, metrics.Expired)
+	os.Exit(0)
+}
+
+func doPrune(c *Command) {
+	keep, err := strconv.ParseUint(c.Parameters["keep"].Value, 10, 64)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	height, err := (&blockchain.Blockchain{}).Prune(keep)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	if height == 0 {
+		fmt.Println("No block was pruned. Bodies are only dropped below a state checkpoint.")
+	} else {
+		fmt.Printf("The transactions of the blocks below %d are pruned.\r\n", height)
+	}
+
+	os.Exit(0)
+}
+
+/* readPassphrase() returns the value of the parameter or asks it on the standard input */
+func readPassphrase(c *Command, name string, prompt string) string {
+	if value := c.Parameters[name].Value; len(value) > 0 {
+		return value
+	}
+
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+func doNewAccount(c *Command) {
+	passphrase := readPassphrase(c, "passphrase", "Passphrase of the wallet: ")
+
+	if !blockchain.HDWalletExists() {
+		mnemonic, err := blockchain.CreateHDWallet(passphrase)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+
+		fmt.Println("HD wallet created. Write down the recovery mnemonic, it restores every account with \"restorewallet\":")
+		fmt.Printf("\r\n%s\r\n\r\n", mnemonic)
+	}
+
+	account, err := blockchain.NewAccount(c.Parameters["label"].Value, passphrase)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Printf("Account %s created.\r\n", account.EncodedAddress())
+	}
+
+	os.Exit(0)
+}
+
+func doRestoreWallet(c *Command) {
+	mnemonic := readPassphrase(c, "mnemonic", "Recovery mnemonic: ")
+	passphrase := readPassphrase(c, "passphrase", "Passphrase of the wallet: ")
+
+	accounts, err := blockchain.RestoreHDWallet(mnemonic, passphrase)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	bc := &blockchain.Blockchain{}
+	for _, account := range accounts {
+		fmt.Printf("Restored %s Balance: %s\r\n", account.EncodedAddress(), bc.Balance(&account.Address))
+	}
+	fmt.Printf("Wallet restored with %d used accounts.\r\n", len(accounts))
+
+	os.Exit(0)
+}
+
+func doPublicKey(c *Command) {
+	account, err := (&blockchain.Account{}).GetAccount(c.Parameters["address"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Public key: 0x%x\r\n", account.PublicKey)
+	os.Exit(0)
+}
+
+func doCreateMultisig(c *Command) {
+	threshold, err := strconv.ParseUint(c.Parameters["threshold"].Value, 10, 8)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	keys := make([][]byte, 0)
+	for _, signer := range strings.Split(c.Parameters["keys"].Value, ",") {
+		signer = strings.TrimSpace(signer)
+
+		if account, err := (&blockchain.Account{}).GetAccount(signer); err == nil {
+			keys = append(keys, account.PublicKey)
+			continue
+		}
+
+		key, err := hex.DecodeString(strings.TrimPrefix(signer, "0x"))
+		if err != nil {
+			fmt.Printf("\"%s\" is not a local account nor a public key.\r\n", signer)
+			os.Exit(0)
+		}
+		keys = append(keys, key)
+	}
+
+	key, err := blockchain.NewMultisigKey(int(threshold), keys)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	account, err := blockchain.CreateMultisigAccount(c.Parameters["label"].Value, key)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Multisig account %s created, %d of %d signatures required.\r\n", account.EncodedAddress(), key.Threshold, len(key.Keys))
+	os.Exit(0)
+}
+
+func doCreatePartial(c *Command) {
+	from := c.Parameters["from"].Value
+
+	numAmmount, err := blockchain.ParseAmount(c.Parameters["ammount"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	bc := &blockchain.Blockchain{}
+	numFee, err := bc.EstimateMultisigFee(from)
+	if fee := c.Parameters["fee"].Value; len(fee) > 0 {
+		numFee, err = blockchain.ParseAmount(fee)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	lockTime := uint64(0)
+	if after := c.Parameters["after"].Value; len(after) > 0 {
+		if lockTime, err = blockchain.ParseLockTime(after); err != nil {
+			fmt.Println(blockchain.ErrInvalidLockTime.Error())
+			os.Exit(0)
+		}
+	}
+
+	partial, err := blockchain.NewPartialTransaction(bc, from, c.Parameters["to"].Value, numAmmount, numFee, lockTime)
+	if err == nil {
+		err = partial.Save(c.Parameters["tx"].Value)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Partially signed transaction 0x%x saved in %s. Fee: %s. It needs %d signatures.\r\n",
+		partial.Transaction.ID, c.Parameters["tx"].Value, partial.Transaction.Fee, partial.Threshold)
+	os.Exit(0)
+}
+
+func doSignPartial(c *Command) {
+	fileName := c.Parameters["tx"].Value
+
+	partial, err := blockchain.LoadPartialTransaction(fileName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	signer, err := blockchain.ParseAddress(c.Parameters["address"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	err = blockchain.Wallet().Unlock(&signer, readPassphrase(c, "passphrase", "Passphrase of the signer: "), 0)
+	if err == nil {
+		err = partial.Sign(c.Parameters["address"].Value)
+		blockchain.Wallet().Lock(&signer)
+	}
+	if err == nil {
+		err = partial.Save(fileName)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Signature added. The transaction has %d of %d signatures.\r\n", len(partial.Signatures), partial.Threshold)
+	os.Exit(0)
+}
+
+func doBroadcast(c *Command) {
+	partial, err := blockchain.LoadPartialTransaction(c.Parameters["tx"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	transaction, err := partial.Broadcast(&blockchain.Blockchain{})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Created the transaction: 0x%x Fee: %s\r\n", transaction.ID, transaction.Fee)
+	os.Exit(0)
+}
+
+func doHTLCLock(c *Command) {
+	from, err := (&blockchain.Account{}).GetAccount(c.Parameters["from"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	recipient, err := blockchain.ParseAddress(c.Parameters["to"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	numAmmount, err := blockchain.ParseAmount(c.Parameters["ammount"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	bc := &blockchain.Blockchain{}
+	numFee := bc.EstimateFeeFor(from.KeyType())
+	if fee := c.Parameters["fee"].Value; len(fee) > 0 {
+		if numFee, err = blockchain.ParseAmount(fee); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+	}
+
+	deadline, err := blockchain.ParseLockTime(c.Parameters["deadline"].Value)
+	if err != nil {
+		fmt.Println(blockchain.ErrInvalidLockTime.Error())
+		os.Exit(0)
+	}
+
+	var preimage []byte
+	hashLock := blockchain.HashBlock{}
+	if hash := c.Parameters["hash"].Value; len(hash) > 0 {
+		err = hashLock.SetHexString(hash)
+	} else {
+		preimage, hashLock, err = blockchain.NewPreimage()
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	contract, err := blockchain.NewHTLC(from.Address, recipient, hashLock, deadline)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	err = blockchain.Wallet().Unlock(&from.Address, readPassphrase(c, "passphrase", "Passphrase of the account: "), 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	transaction, err := blockchain.LockHTLC(bc, contract, numAmmount, numFee)
+	blockchain.Wallet().Lock(&from.Address)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	address := contract.Address()
+	fmt.Printf("Created the transaction: 0x%x Fee: %s\r\n", transaction.ID, transaction.Fee)
+	fmt.Printf("Contract %s: 0x%x\r\n", blockchain.EncodeAddress(&address), contract.Bytes())
+	if preimage != nil {
+		fmt.Printf("Preimage: 0x%x. Keep it secret until the recipient should claim the coins.\r\n", preimage)
+	}
+
+	os.Exit(0)
+}
+
+/* readHTLC() parses the contract parameter */
+func readHTLC(c *Command) *blockchain.HTLC {
+	data, err := hex.DecodeString(strings.TrimPrefix(c.Parameters["contract"].Value, "0x"))
+	if err != nil {
+		fmt.Println(blockchain.ErrInvalidHTLC.Error())
+		os.Exit(0)
+	}
+
+	contract, err := blockchain.ParseHTLC(data)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	return contract
+}
+
+func doHTLCClaim(c *Command) {
+	contract := readHTLC(c)
+
+	preimage, err := hex.DecodeString(strings.TrimPrefix(c.Parameters["preimage"].Value, "0x"))
+	if err != nil {
+		fmt.Println(blockchain.ErrInvalidPreimage.Error())
+		os.Exit(0)
+	}
+
+	err = blockchain.Wallet().Unlock(&contract.Recipient, readPassphrase(c, "passphrase", "Passphrase of the recipient: "), 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	transaction, err := blockchain.ClaimHTLC(&blockchain.Blockchain{}, contract, preimage)
+	blockchain.Wallet().Lock(&contract.Recipient)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Created the transaction: 0x%x Ammount: %s Fee: %s\r\n", transaction.ID, transaction.Ammount, transaction.Fee)
+	os.Exit(0)
+}
+
+func doHTLCRefund(c *Command) {
+	contract := readHTLC(c)
+
+	err := blockchain.Wallet().Unlock(&contract.Sender, readPassphrase(c, "passphrase", "Passphrase of the sender: "), 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	transaction, err := blockchain.RefundHTLC(&blockchain.Blockchain{}, contract)
+	blockchain.Wallet().Lock(&contract.Sender)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Created the transaction: 0x%x Ammount: %s Fee: %s\r\n", transaction.ID, transaction.Ammount, transaction.Fee)
+	fmt.Printf("The mempool holds it until the deadline %d.\r\n", contract.Deadline)
+	os.Exit(0)
+}
+
+func doHTLCStatus(c *Command) {
+	contract := readHTLC(c)
+	bc := &blockchain.Blockchain{}
+	address := contract.Address()
+
+	fmt.Printf("Contract:  %s\r\n", blockchain.EncodeAddress(&address))
+	fmt.Printf("Sender:    %s\r\n", blockchain.EncodeAddress(&contract.Sender))
+	fmt.Printf("Recipient: %s\r\n", blockchain.EncodeAddress(&contract.Recipient))
+	fmt.Printf("Hash lock: 0x%x\r\n", contract.HashLock)
+	fmt.Printf("Deadline:  %d\r\n", contract.Deadline)
+	balance := bc.Balance(&address)
+	fmt.Printf("Balance:   %s\r\n", balance)
+
+	tip := bc.CurrentBlock()
+	if balance > 0 && contract.Expired(tip.Id+1, uint64(time.Now().Unix())) {
+		fmt.Println("The deadline has passed, the sender can take the coins back with \"htlcrefund\".")
+	}
+
+	preimage, err := bc.RevealedPreimage(contract)
+	if err != nil {
+		fmt.Printf("Claim unknown: %s. Ask a node keeping every block.\r\n", err.Error())
+	} else if preimage != nil {
+		fmt.Printf("Claimed, preimage: 0x%x\r\n", preimage)
+	}
+
+	os.Exit(0)
+}
+
+/* readContractCode() returns the bytecode in hex of the parameter, or assembles the file it names */
+func readContractCode(c *Command) []byte {
+	value := c.Parameters["code"].Value
+	if strings.HasPrefix(value, "0x") {
+		code, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		return code
+	}
+
+	source, err := os.ReadFile(value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	code, err := vm.Assemble(string(source))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	return code
+}
+
+/* readGasAndFee() returns the gas limit and the fee parameters, or their defaults for the data */
+func readGasAndFee(c *Command, bc *blockchain.Blockchain, account *blockchain.Account, data []byte) (ammount blockchain.Amount, gasLimit uint64, fee blockchain.Amount) {
+	var err error
+
+	if value := c.Parameters["ammount"].Value; len(value) > 0 {
+		if ammount, err = blockchain.ParseAmount(value); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+	}
+
+	gasLimit = blockchain.DefaultGasLimit
+	if value := c.Parameters["gas"].Value; len(value) > 0 {
+		if gasLimit, err = strconv.ParseUint(value, 10, 64); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+	}
+
+	fee, err = bc.EstimateContractFee(account.KeyType(), data, gasLimit)
+	if value := c.Parameters["fee"].Value; len(value) > 0 {
+		fee, err = blockchain.ParseAmount(value)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	return ammount, gasLimit, fee
+}
+
+func printExecution(result *vm.Result) {
+	if result.Err != nil {
+		fmt.Printf("  Failed: %s\r\n", result.Err.Error())
+	} else {
+		fmt.Println("  Succeeded")
+	}
+
+	fmt.Printf("  Gas used: %d\r\n", result.GasUsed)
+	if result.Return != nil {
+		fmt.Printf("  Return: 0x%x\r\n", result.Return)
+	}
+
+	for _, log := range result.Logs {
+		fmt.Printf("  Log: data 0x%x", log.Data)
+		for _, topic := range log.Topics {
+			fmt.Printf(" topic 0x%x", topic)
+		}
+		fmt.Println()
+	}
+}
+
+func doCompile(c *Command) {
+	source, err := os.ReadFile(c.Parameters["source"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	code, err := vm.Assemble(string(source))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Bytecode (%d bytes): 0x%x\r\n\r\n", len(code), code)
+	fmt.Print(vm.Disassemble(code))
+	os.Exit(0)
+}
+
+func doRunContract(c *Command) {
+	code := readContractCode(c)
+	host := vm.NewMemoryHost()
+	context := &vm.Context{Time: uint64(time.Now().Unix()), Gas: blockchain.Params().MaxTransactionGas}
+
+	if caller := c.Parameters["caller"].Value; len(caller) > 0 {
+		address, err := blockchain.ParseAddress(caller)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+		context.Caller = vm.Word(address)
+	}
+
+	var value blockchain.Amount
+	if ammount := c.Parameters["value"].Value; len(ammount) > 0 {
+		var err error
+		if value, err = blockchain.ParseAmount(ammount); err != nil || value < 0 {
+			fmt.Println(blockchain.ErrInvalidAmount.Error())
+			os.Exit(0)
+		}
+	}
+
+	fmt.Println("Deployment")
+	result := vm.Execute(code, context, host)
+	host.Commit(context, result)
+	printExecution(result)
+
+	for i, call := range strings.Split(c.Parameters["calls"].Value, ";") {
+		if len(strings.TrimSpace(call)) == 0 {
+			continue
+		}
+
+		input, err := blockchain.EncodeContractInput(call)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+
+		context.Input = input
+		context.Value = uint64(value)
+		context.Height++
+
+		fmt.Printf("Call %d: %s\r\n", i+1, strings.TrimSpace(call))
+		result = vm.Execute(code, context, host)
+		host.Commit(context, result)
+		printExecution(result)
+	}
+
+	keys := make([]vm.Word, 0)
+	for key := range host.Storage[context.Address] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+
+	fmt.Println("Storage")
+	for _, key := range keys {
+		fmt.Printf("  0x%x = 0x%x\r\n", key, host.Storage[context.Address][key])
+	}
+
+	os.Exit(0)
+}
+
+func doDeploy(c *Command) {
+	account, err := (&blockchain.Account{}).GetAccount(c.Parameters["from"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	code := readContractCode(c)
+	bc := &blockchain.Blockchain{}
+	ammount, gasLimit, fee := readGasAndFee(c, bc, account, code)
+
+	err = blockchain.Wallet().Unlock(&account.Address, readPassphrase(c, "passphrase", "Passphrase of the account: "), 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	result, err := bc.NewContractTransaction(account.EncodedAddress(), "", ammount, fee, gasLimit, code)
+	blockchain.Wallet().Lock(&account.Address)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	contract := blockchain.ContractAddress(&result.From, result.Nonce)
+	fmt.Printf("Created the transaction: 0x%x Fee: %s\r\n", result.ID, result.Fee)
+	fmt.Printf("Contract address: %s\r\n", blockchain.EncodeAddress(&contract))
+	os.Exit(0)
+}
+
+func doCall(c *Command) {
+	account, err := (&blockchain.Account{}).GetAccount(c.Parameters["from"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	input, err := blockchain.EncodeContractInput(c.Parameters["input"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+	bc := &blockchain.Blockchain{}
+	ammount, gasLimit, fee := readGasAndFee(c, bc, account, input)
+
+	err = blockchain.Wallet().Unlock(&account.Address, readPassphrase(c, "passphrase", "Passphrase of the account: "), 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	result, err := bc.NewContractTransaction(account.EncodedAddress(), c.Parameters["to"].Value, ammount, fee, gasLimit, input)
+	blockchain.Wallet().Lock(&account.Address)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Created the transaction: 0x%x Fee: %s\r\n", result.ID, result.Fee)
+	os.Exit(0)
+}
+
+func doReceipt(c *Command) {
+	id := &blockchain.HashBlock{}
+	if err := id.SetHexString(c.Parameters["tx"].Value); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
 
-	if len(port) > 0 {
-		numPort, err := strconv.ParseInt(port, 10, 32)
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(0)
-		}
-		ws.UsePort(int(numPort))
+	receipt, err := (&blockchain.Blockchain{}).Receipt(id)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
 	}
 
-	started := make(chan bool)
-	go func(w *webserver.WebServer) {
-		w.Start(started)
-	}(ws)
+	fmt.Printf("Transaction: 0x%x\r\n", receipt.Transaction)
+	fmt.Printf("  Block: %d 0x%x\r\n", receipt.BlockId, receipt.BlockHash)
+	fmt.Printf("  Position: %d\r\n", receipt.Index)
+	if receipt.Status == blockchain.ReceiptSuccess {
+		fmt.Println("  Succeeded")
+	} else {
+		fmt.Printf("  Failed: %s\r\n", receipt.Error)
+	}
 
-	if <-started {
-		log.Println("WebServer started!")
+	fmt.Printf("  Fee: %s\r\n", receipt.Fee)
+	if receipt.GasUsed > 0 {
+		fmt.Printf("  Gas used: %d\r\n", receipt.GasUsed)
+	}
+
+	if receipt.Contract != nil {
+		fmt.Printf("  Contract: %s\r\n", blockchain.EncodeAddress(receipt.Contract))
+	}
+
+	if receipt.Return != nil {
+		fmt.Printf("  Return: 0x%x\r\n", receipt.Return)
+	}
+
+	for _, log := range receipt.Logs {
+		fmt.Printf("  Log: %s data 0x%x", blockchain.EncodeAddress(&log.Address), log.Data)
+		for _, topic := range log.Topics {
+			fmt.Printf(" topic 0x%x", topic)
+		}
+		fmt.Println()
 	}
+
+	os.Exit(0)
 }
 
-func doStartNode(c *Command) {
-	blockchainNode := &blockchain.BlockchainNode{}
-	port := c.Parameters["port"].Value
+func doQueryContract(c *Command) {
+	contract, err := blockchain.ParseAddress(c.Parameters["to"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
 
-	if len(port) > 0 {
-		numPort, err := strconv.ParseInt(port, 10, 32)
-		if err != nil {
+	caller := blockchain.HashBlock{}
+	if from := c.Parameters["from"].Value; len(from) > 0 {
+		if caller, err = blockchain.ParseAddress(from); err != nil {
 			fmt.Println(err.Error())
 			os.Exit(0)
 		}
-		blockchainNode.UsePort(int(numPort))
 	}
 
-	blockchainNode.StartListener()
+	input, err := blockchain.EncodeContractInput(c.Parameters["input"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	result, err := (&blockchain.Blockchain{}).QueryContract(&caller, &contract, input)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Contract %s\r\n", blockchain.EncodeAddress(&contract))
+	printExecution(result)
+	os.Exit(0)
 }
 
-func doNewAccount(c *Command) {
-	account, err := blockchain.NewAccount(c.Parameters["label"].Value)
+func doPassphrase(c *Command) {
+	address, err := blockchain.ParseAddress(c.Parameters["address"].Value)
 	if err != nil {
 		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	passphrase := readPassphrase(c, "old", "Current passphrase: ")
+	newPassphrase := readPassphrase(c, "new", "New passphrase: ")
+
+	if err = blockchain.Wallet().ChangePassphrase(&address, passphrase, newPassphrase); err != nil {
+		fmt.Println(err.Error())
 	} else {
-		fmt.Printf("Account 0x%x created.\r\n", account.Address)
+		fmt.Printf("Passphrase of the account %s changed.\r\n", blockchain.EncodeAddress(&address))
 	}
 
 	os.Exit(0)
@@ -185,8 +1257,20 @@ func doStartMiner(c *Command) {
 		BenchmarkMode = benchmark == "yes"
 	}
 
+	config, err := blockchain.LoadMinerConfig()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	wallet, err := config.WalletAddress()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
 	miners := make([]*blockchain.Miner, NumThreads)
-	bc := &blockchain.Blockchain{}
+	bc := &blockchain.Blockchain{MinerAddress: *wallet}
 	block := bc.CurrentBlock()
 
 	i := block.Id
@@ -195,6 +1279,7 @@ func doStartMiner(c *Command) {
 
 	log.Printf("Current Block: [id:%d diff:%d hash:%x]\r\n", i, d, h)
 	log.Printf("Started miner engine with %d threds.\r\n", len(miners))
+	log.Printf("Block rewards paid to %s\r\n", blockchain.EncodeAddress(wallet))
 
 	for i := 0; i < NumThreads; i++ {
 
@@ -241,50 +1326,285 @@ func displayHelp(c *Command) {
 
 		fmt.Println()
 	}
+
+	fmt.Printf("%-15s[network:value] Select the network of any command: main, test or regtest. Default is %s\r\n", "Global", blockchain.DefaultNetwork)
 	os.Exit(0)
 }
 
 func doSend(c *Command) {
 	from := c.Parameters["from"].Value
 	to := c.Parameters["to"].Value
-	numAmmount, err := strconv.ParseFloat(c.Parameters["ammount"].Value, 64)
+	numAmmount, err := blockchain.ParseAmount(c.Parameters["ammount"].Value)
 	if err != nil {
 		panic(err)
 	}
 
 	if numAmmount <= 0 {
-		log.Panicf("Invalid ammount: %0.f\r\n", numAmmount)
+		log.Panicf("Invalid ammount: %s\r\n", numAmmount)
+	}
+
+	account, err := (&blockchain.Account{}).GetAccount(from)
+	if err != nil {
+		panic(err)
+	}
+
+	if account.KeyType() == blockchain.KeyTypeMultisig {
+		panic(blockchain.ErrMultisigAccount)
+	}
+
+	bc := &blockchain.Blockchain{}
+	numFee := bc.EstimateFeeFor(account.KeyType())
+	if fee := c.Parameters["fee"].Value; len(fee) > 0 {
+		numFee, err = blockchain.ParseAmount(fee)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	lockTime := uint64(0)
+	if after := c.Parameters["after"].Value; len(after) > 0 {
+		if lockTime, err = blockchain.ParseLockTime(after); err != nil {
+			panic(blockchain.ErrInvalidLockTime)
+		}
+	}
+
+	err = blockchain.Wallet().Unlock(&account.Address, readPassphrase(c, "passphrase", "Passphrase of the account: "), 0)
+	if err != nil {
+		panic(err)
 	}
 
-	transaction := &blockchain.Transaction{}
-	result, err := transaction.NewTransaction(from, to, numAmmount)
+	result, err := bc.NewTransaction(from, to, numAmmount, numFee, lockTime)
+	blockchain.Wallet().Lock(&account.Address)
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("Created the transaction: 0x%x\r\n", result.ID)
+	fmt.Printf("Created the transaction: 0x%x Fee: %s\r\n", result.ID, result.Fee)
+	if result.LockTime > 0 {
+		fmt.Printf("The mempool holds it until the lock time %d.\r\n", result.LockTime)
+	}
 
 	os.Exit(0)
 }
 
-func doAirdrop(c *Command) {
-	to := c.Parameters["to"].Value
-	ammount := c.Parameters["ammount"].Value
-	numAmmount, err := strconv.ParseFloat(ammount, 64)
+func doMerkleProof(c *Command) {
+	blockId, err := strconv.ParseUint(c.Parameters["block"].Value, 10, 64)
 	if err != nil {
-		panic(err)
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	txHash := &blockchain.HashBlock{}
+	if err := txHash.SetHexString(c.Parameters["tx"].Value); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	block, err := (&blockchain.Blockchain{}).GetBlock(blockId)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	proof, err := block.MerkleProof(txHash)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	jstr, _ := json.Marshal(proof)
+	fmt.Println(string(jstr))
+
+	os.Exit(0)
+}
+
+func doVerifyProof(c *Command) {
+	data, err := os.ReadFile(c.Parameters["proof"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	proof := &blockchain.MerkleProof{}
+	if err := json.Unmarshal(data, proof); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	root := &blockchain.HashBlock{}
+	if len(c.Parameters["root"].Value) > 0 {
+		err = root.SetHexString(c.Parameters["root"].Value)
+	} else {
+		var block *blockchain.Block
+		block, err = (&blockchain.Blockchain{}).GetBlock(proof.BlockId)
+		if err == nil {
+			root.Set(&block.Merkle)
+		}
+	}
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	if proof.Verify(root) {
+		fmt.Printf("Transaction 0x%x is included in the block %d.\r\n", proof.TxHash, proof.BlockId)
+	} else {
+		fmt.Println(blockchain.ErrInvalidMerkleProof.Error())
+	}
+
+	os.Exit(0)
+}
+
+func doBalanceProof(c *Command) {
+	address, err := blockchain.ParseAddress(c.Parameters["address"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	proof, err := (&blockchain.Blockchain{}).BalanceProof(&address)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	jstr, _ := json.Marshal(proof)
+	fmt.Println(string(jstr))
+
+	os.Exit(0)
+}
+
+func doVerifyBalance(c *Command) {
+	data, err := os.ReadFile(c.Parameters["proof"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	proof := &blockchain.BalanceProof{}
+	if err := json.Unmarshal(data, proof); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	root := &blockchain.HashBlock{}
+	if len(c.Parameters["root"].Value) > 0 {
+		err = root.SetHexString(c.Parameters["root"].Value)
+	} else {
+		var block *blockchain.Block
+		block, err = (&blockchain.Blockchain{}).GetBlock(proof.BlockId)
+		if err == nil {
+			root.Set(&block.StateRoot)
+		}
+	}
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
 	}
 
-	if numAmmount <= 0 || numAmmount > 10000 {
-		log.Panicf("Invalid ammount: %0.f. Range allowed must be greater than 0 up to 10000.\r\n", numAmmount)
+	if proof.Verify(root) {
+		fmt.Printf("Account %s has the balance %s at the block %d.\r\n", blockchain.EncodeAddress(&proof.Address), proof.Balance, proof.BlockId)
+	} else {
+		fmt.Println(blockchain.ErrInvalidBalanceProof.Error())
 	}
 
-	account, err := blockchain.Airdrop(to, numAmmount)
+	os.Exit(0)
+}
+
+func doRebuildState(c *Command) {
+	state, err := (&blockchain.Blockchain{}).RebuildState()
 	if err != nil {
 		fmt.Println(err.Error())
 	} else {
-		fmt.Printf("Balance: %0.8f\r\n", account.Balance)
+		fmt.Printf("Ledger state rebuilt with %d blocks and %d accounts.\r\n", state.Height, len(state.Balances))
+	}
+
+	os.Exit(0)
+}
+
+func doGenerate(c *Command) {
+	count, err := strconv.ParseInt(c.Parameters["blocks"].Value, 10, 32)
+	if err != nil || count < 1 {
+		fmt.Printf("\"%s\" is an invalid number of blocks.\r\n", c.Parameters["blocks"].Value)
+		os.Exit(0)
+	}
+
+	wallet := &blockchain.HashBlock{}
+	if address := c.Parameters["address"].Value; len(address) > 0 {
+		*wallet, err = blockchain.ParseAddress(address)
+	} else {
+		var config *blockchain.MinerConfig
+		config, err = blockchain.LoadMinerConfig()
+		if err == nil {
+			wallet, err = config.WalletAddress()
+		}
+	}
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	miner := &blockchain.Miner{Blockchain: &blockchain.Blockchain{MinerAddress: *wallet}}
+	for _, block := range miner.Generate(int(count)) {
+		fmt.Printf("Block %d 0x%x\r\n", block.Id, block.Hash[:])
+	}
+
+	os.Exit(0)
+}
+
+func doInit(c *Command) {
+	fileName := c.Parameters["genesis"].Value
+	if len(fileName) == 0 {
+		fileName = blockchain.Net().DataFile(blockchain.GenesisTemplateFileName)
+	}
+
+	genesis, err := blockchain.InitGenesis(fileName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	fmt.Printf("Genesis block created with %d allocations.\r\n", len(genesis.Transactions))
+	fmt.Printf("Genesis hash: 0x%x\r\n", genesis.Hash[:])
+	fmt.Printf("State root: 0x%x\r\n", genesis.StateRoot[:])
+
+	os.Exit(0)
+}
+
+func doSubmitBlock(c *Command) {
+	data, err := os.ReadFile(c.Parameters["block"].Value)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	block := &blockchain.Block{}
+	if err := json.Unmarshal(data, block); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
+	}
+
+	bc := &blockchain.Blockchain{}
+	if err := bc.AddBlock(block); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(0)
 	}
+
+	tip := bc.CurrentBlock()
+	fmt.Printf("Block %d accepted. Best chain tip is the block %d 0x%x.\r\n", block.Id, tip.Id, tip.Hash[:])
+
+	os.Exit(0)
+}
+
+func doEstimateFee(c *Command) {
+	bc := &blockchain.Blockchain{}
+
+	fmt.Printf("Fee rate: %s per byte\r\n", bc.EstimateFeeRate())
+	fmt.Printf("Suggested fee: %s\r\n", bc.EstimateFee())
+
 	os.Exit(0)
 }
 
@@ -292,13 +1612,29 @@ func init() {
 
 	buildCommandList()
 
-	if len(os.Args) <= 1 {
+	args := make([]string, 0, len(os.Args))
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "network:") {
+			args = append(args, arg)
+			continue
+		}
+
+		if err := blockchain.SelectNetwork(strings.TrimPrefix(arg, "network:")); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(0)
+		}
+	}
+
+	if len(args) == 0 {
+		if len(os.Args) > 1 {
+			displayHelp(nil)
+		}
 		return
 	}
 
-	c := Commands[os.Args[1]]
+	c := Commands[args[0]]
 	if c == nil {
-		fmt.Printf("The command \"%s\" is not recognized.\r\n", os.Args[1])
+		fmt.Printf("The command \"%s\" is not recognized.\r\n", args[0])
 		os.Exit(0)
 	}
 
@@ -308,10 +1644,10 @@ func init() {
 		os.Exit(0)
 	}
 
-	for i := 2; i < len(os.Args); i++ {
-		items := strings.Split(os.Args[i], ":")
+	for i := 1; i < len(args); i++ {
+		items := strings.SplitN(args[i], ":", 2)
 		if len(items) < 2 {
-			fnInvalidParameter(c, os.Args[i])
+			fnInvalidParameter(c, args[i])
 		}
 
 		parameter := c.Parameters[items[0]]
@@ -0,0 +1,32 @@
+; Counter: input word 0 = 1 adds one to the count, any other value reads it. Both return the count
+; The deployment runs with an empty input and leaves the count at zero
+
+    CALLDATASIZE
+    ISZERO
+    PUSH deployed
+    JUMPI
+    PUSH 0
+    CALLDATALOAD
+    PUSH 1
+    EQ
+    PUSH increment
+    JUMPI
+    PUSH 0
+    SLOAD
+    RETURN
+
+increment:
+    PUSH 0
+    SLOAD
+    PUSH 1
+    ADD
+    DUP1
+    PUSH 0
+    SSTORE
+    PUSH 0x436f756e746564       ; topic "Counted", the new count as data
+    DUP2
+    LOG1
+    RETURN
+
+deployed:
+    STOP
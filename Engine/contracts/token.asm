@@ -0,0 +1,70 @@
+; Token: fungible token whose balances are kept in the storage, one slot per holder address
+; The deployment mints 1000000 tokens to the deployer
+; Input word 0 selects the function: 1 = transfer(word 1 recipient, word 2 ammount), 2 = balanceOf(word 1 holder)
+
+    CALLDATASIZE
+    PUSH dispatch
+    JUMPI
+    PUSH 1000000
+    CALLER
+    SSTORE
+    STOP
+
+dispatch:
+    PUSH 0
+    CALLDATALOAD
+    DUP1
+    PUSH 1
+    EQ
+    PUSH transfer
+    JUMPI
+    PUSH 2
+    EQ
+    PUSH balanceof
+    JUMPI
+    PUSH 0                      ; unknown function
+    REVERT
+
+transfer:
+    POP
+    PUSH 64
+    CALLDATALOAD                ; ammount
+    CALLER
+    SLOAD                       ; ammount, balance of the sender
+    DUP2
+    DUP2
+    LT
+    PUSH insufficient
+    JUMPI
+    DUP2
+    SWAP1
+    SUB
+    CALLER
+    SSTORE                      ; sender balance -= ammount
+    PUSH 32
+    CALLDATALOAD
+    DUP1
+    SLOAD
+    DUP3
+    ADD
+    SWAP1
+    SSTORE                      ; recipient balance += ammount
+    PUSH 32
+    CALLDATALOAD
+    CALLER
+    PUSH 0x5472616e73666572         ; topics "Transfer", sender and recipient, the ammount as data
+    DUP4
+    LOG3
+    POP
+    PUSH 1
+    RETURN
+
+insufficient:
+    PUSH 1
+    REVERT
+
+balanceof:
+    PUSH 32
+    CALLDATALOAD
+    SLOAD
+    RETURN
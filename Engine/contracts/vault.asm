@@ -0,0 +1,47 @@
+; Vault: keeps the coins sent to it, which only the deployer can withdraw
+; The deployment saves the deployer as the owner in slot 0
+; Input word 0 selects the function: 1 = withdraw(word 1 ammount) to the owner, any other value returns the balance
+
+    CALLDATASIZE
+    PUSH dispatch
+    JUMPI
+    CALLER
+    PUSH 0
+    SSTORE
+    STOP
+
+dispatch:
+    PUSH 0
+    CALLDATALOAD
+    PUSH 1
+    EQ
+    PUSH withdraw
+    JUMPI
+    ADDRESS
+    BALANCE
+    RETURN
+
+withdraw:
+    PUSH 0
+    SLOAD
+    CALLER
+    EQ
+    ISZERO
+    PUSH denied
+    JUMPI
+    PUSH 32
+    CALLDATALOAD
+    PUSH 0
+    SLOAD
+    TRANSFER
+    PUSH 0x5769746864726177           ; topic "Withdraw", the ammount as data
+    PUSH 32
+    CALLDATALOAD
+    LOG1
+    ADDRESS
+    BALANCE
+    RETURN
+
+denied:
+    PUSH 2
+    REVERT
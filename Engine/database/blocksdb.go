@@ -1,5 +1,11 @@
 package database
 
+import (
+	"errors"
+	"os"
+	"path"
+)
+
 type BlockDB struct {
 	db DatabaseFile
 }
@@ -20,6 +26,25 @@ func (b *BlockDB) Add(block []byte) (err error) {
 	return err
 }
 
+func (b *BlockDB) RemoveLast() (err error) {
+
+	if !b.db.IsOpen() {
+		return ErrClosed
+	}
+
+	return b.db.DeleteLast()
+}
+
+/* Clear() removes every block */
+func (b *BlockDB) Clear() (err error) {
+
+	if !b.db.IsOpen() {
+		return ErrClosed
+	}
+
+	return b.db.Clear()
+}
+
 func (b *BlockDB) Close() {
 	b.db.Close()
 }
@@ -39,3 +64,31 @@ func (b *BlockDB) LoadData(loaderFunc func([]byte)) {
 	b.db.ForEach(loaderFunc)
 
 }
+
+/* Replace() writes the records to a temporary file renamed over blocks.dat, so a failure leaves the old file intact */
+func (b *BlockDB) Replace(records [][]byte) (err error) {
+	tempName := BlocksFileName + ".tmp"
+
+	temp := &DatabaseFile{}
+	err = temp.Open(tempName)
+	if err != nil && !errors.Is(err, ErrEmpty) {
+		return err
+	}
+
+	err = temp.Clear()
+	for i := 0; err == nil && i < len(records); i++ {
+		err = temp.Write(records[i])
+	}
+
+	if err == nil {
+		err = temp.db.Sync()
+	}
+	temp.Close()
+
+	if err != nil {
+		os.Remove(path.Join(DatabasePath, tempName))
+		return err
+	}
+
+	return os.Rename(path.Join(DatabasePath, tempName), path.Join(DatabasePath, BlocksFileName))
+}
@@ -1,10 +1,16 @@
 package database
 
+/* Data directory of the selected network */
+var DatabasePath = "./db"
+
 const (
-	DatabasePath         = "./db"
 	BlocksFileName       = "blocks.dat"
 	TransactionsFileName = "transactions.dat"
 	AccountsFileName     = "accounts.dat"
+	StateFileName        = "state.dat"
+	SideBlocksFileName   = "sideblocks.dat"
+	ReceiptsFileName     = "receipts.dat"
+	HeadersFileName      = "headers.dat" // Headers-only store of the light client
 )
 
 type (
@@ -274,6 +274,84 @@ func (d *DatabaseFile) WriteCurrent(data []byte) (err error) {
 	return err
 }
 
+/* Clear() removes all the records of the database file, keeping only an empty header */
+func (d *DatabaseFile) Clear() error {
+	if !d.IsOpen() {
+		return ErrClosed
+	}
+
+	err := d.db.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	d.headerInfo = DatabaseHeaderInfos{Version: CurrentDatabaseVersion}
+	d.rootNode = nil
+	d.currentNode = nil
+
+	return d.createHeader()
+}
+
+/* DeleteLast() removes the last record and truncates the database file */
+func (d *DatabaseFile) DeleteLast() error {
+	if !d.IsOpen() {
+		return ErrClosed
+	}
+
+	lastNode, err := d.getLastNode()
+	if err != nil {
+		return err
+	}
+
+	if lastNode.Header.Previous == BOF {
+		return d.Clear()
+	}
+
+	previousNode, err := d.getNode(lastNode.Header.Previous)
+	if err != nil {
+		return err
+	}
+
+	previousNode.Header.Next = EOF
+
+	_, err = d.db.Seek(previousNode.Header.Position, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(d.db, binary.LittleEndian, &previousNode.Header)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.Truncate(lastNode.Header.Position)
+	if err != nil {
+		return err
+	}
+
+	d.headerInfo.LastNodePosition = previousNode.Header.Position
+	d.headerInfo.NodesCount--
+	d.headerInfo.TotalLength -= int64(lastNode.Header.DataLength)
+	d.currentNode = nil
+	d.rootNode = nil
+
+	return d.writeHeader()
+}
+
+/* Version() is the format version of the records, managed by the owner of the database file */
+func (d *DatabaseFile) Version() uint8 {
+	return d.headerInfo.Version
+}
+
+func (d *DatabaseFile) SetVersion(version uint8) error {
+	if !d.IsOpen() {
+		return ErrClosed
+	}
+
+	d.headerInfo.Version = version
+	return d.writeHeader()
+}
+
 func (d *DatabaseFile) Count() int64 {
 	return d.headerInfo.NodesCount
 }
@@ -466,11 +544,15 @@ func (d *DatabaseFile) Update(data []byte, whereFunc func([]byte) bool) (err err
 	}
 
 	for {
+		position := d.currentNode.Header.Position
 		existingData, err := d.Read()
 		found := whereFunc(existingData)
 		if found {
-			d.WriteCurrent(data)
-			return nil
+			d.currentNode, err = d.getNode(position)
+			if err != nil {
+				return err
+			}
+			return d.WriteCurrent(data)
 		}
 
 		if errors.Is(err, ErrEof) {
@@ -481,8 +563,19 @@ func (d *DatabaseFile) Update(data []byte, whereFunc func([]byte) bool) (err err
 	return ErrNotFound
 }
 
+/* UseDatabasePath() moves the databases to another directory, creating it when needed */
+func UseDatabasePath(dir string) error {
+	err := os.MkdirAll(dir, os.ModeDir|0775)
+	if err != nil {
+		return err
+	}
+
+	DatabasePath = dir
+	return nil
+}
+
 func init() {
-	err := os.MkdirAll(DatabasePath, os.ModeDir)
+	err := UseDatabasePath(DatabasePath)
 	if err != nil {
 		panic(err)
 	}
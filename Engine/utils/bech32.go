@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var (
+	ErrBech32Format   = errors.New("invalid bech32 string")
+	ErrBech32Checksum = errors.New("bech32 checksum does not match, the string is mistyped")
+)
+
+var bech32Generator = []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+func bech32ExpandPrefix(prefix string) (result []byte) {
+	result = make([]byte, 0, len(prefix)*2+1)
+
+	for i := 0; i < len(prefix); i++ {
+		result = append(result, prefix[i]>>5)
+	}
+	result = append(result, 0)
+
+	for i := 0; i < len(prefix); i++ {
+		result = append(result, prefix[i]&31)
+	}
+
+	return result
+}
+
+/* convertBits() regroups the bits of data from groups of "from" bits to groups of "to" bits */
+func convertBits(data []byte, from uint, to uint, pad bool) (result []byte, err error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxValue := uint32(1)<<to - 1
+
+	for _, value := range data {
+		if uint32(value)>>from != 0 {
+			return nil, ErrBech32Format
+		}
+
+		acc = acc<<from | uint32(value)
+		bits += from
+
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(to-bits)&maxValue))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxValue != 0 {
+		return nil, ErrBech32Format
+	}
+
+	return result, nil
+}
+
+/* Bech32Encode() encodes data as defined by BIP-173, with prefix as the human readable part */
+func Bech32Encode(prefix string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	checksumInput := append(bech32ExpandPrefix(prefix), values...)
+	checksumInput = append(checksumInput, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(checksumInput) ^ 1
+
+	result := strings.Builder{}
+	result.WriteString(prefix)
+	result.WriteByte('1')
+
+	for _, value := range values {
+		result.WriteByte(bech32Charset[value])
+	}
+
+	for i := 0; i < 6; i++ {
+		result.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+
+	return result.String(), nil
+}
+
+/* Bech32Decode() returns the human readable prefix and the data of a bech32 string, validating its checksum */
+func Bech32Decode(str string) (prefix string, data []byte, err error) {
+	if strings.ToLower(str) != str && strings.ToUpper(str) != str {
+		return "", nil, ErrBech32Format
+	}
+	str = strings.ToLower(str)
+
+	separator := strings.LastIndexByte(str, '1')
+	if separator < 1 || separator+7 > len(str) {
+		return "", nil, ErrBech32Format
+	}
+
+	prefix = str[:separator]
+	values := make([]byte, 0, len(str)-separator-1)
+
+	for i := separator + 1; i < len(str); i++ {
+		value := strings.IndexByte(bech32Charset, str[i])
+		if value < 0 {
+			return "", nil, ErrBech32Format
+		}
+		values = append(values, byte(value))
+	}
+
+	if bech32Polymod(append(bech32ExpandPrefix(prefix), values...)) != 1 {
+		return "", nil, ErrBech32Checksum
+	}
+
+	data, err = convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prefix, data, nil
+}
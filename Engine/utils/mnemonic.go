@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/* English word list of BIP-39 */
+//go:embed bip39_english.txt
+var bip39English string
+
+var (
+	mnemonicWords = strings.Fields(bip39English)
+	mnemonicIndex = make(map[string]int)
+)
+
+var (
+	ErrMnemonicLength   = errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+	ErrMnemonicWord     = errors.New("mnemonic has a word that is not in the BIP-39 english word list")
+	ErrMnemonicChecksum = errors.New("mnemonic checksum does not match, a word is mistyped or out of order")
+)
+
+func init() {
+	for i, word := range mnemonicWords {
+		mnemonicIndex[word] = i
+	}
+}
+
+/* NewMnemonic() creates a BIP-39 mnemonic with the given bits of random entropy, 128 for 12 words up to 256 for 24 words */
+func NewMnemonic(entropyBits int) (string, error) {
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", ErrMnemonicLength
+	}
+
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+
+	return EntropyToMnemonic(entropy)
+}
+
+/* EntropyToMnemonic() appends the checksum bits to the entropy and maps each group of 11 bits to a word */
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	entropyBits := len(entropy) * 8
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", ErrMnemonicLength
+	}
+
+	checksumBits := entropyBits / 32
+	checksum := sha256.Sum256(entropy)
+
+	value := new(big.Int).SetBytes(entropy)
+	value.Lsh(value, uint(checksumBits))
+	value.Or(value, big.NewInt(int64(checksum[0]>>(8-checksumBits))))
+
+	count := (entropyBits + checksumBits) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+
+	for i := count - 1; i >= 0; i-- {
+		words[i] = mnemonicWords[new(big.Int).And(value, mask).Int64()]
+		value.Rsh(value, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+/* MnemonicToEntropy() returns the entropy of a mnemonic, checking its words and checksum */
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrMnemonicLength
+	}
+
+	value := new(big.Int)
+	for _, word := range words {
+		index, ok := mnemonicIndex[strings.ToLower(word)]
+		if !ok {
+			return nil, ErrMnemonicWord
+		}
+
+		value.Lsh(value, 11)
+		value.Or(value, big.NewInt(int64(index)))
+	}
+
+	checksumBits := len(words) / 3
+	checksum := new(big.Int).And(value, big.NewInt(int64(1)<<checksumBits-1)).Int64()
+	value.Rsh(value, uint(checksumBits))
+
+	entropy := make([]byte, checksumBits*4)
+	value.FillBytes(entropy)
+
+	expected := sha256.Sum256(entropy)
+	if int64(expected[0]>>(8-checksumBits)) != checksum {
+		return nil, ErrMnemonicChecksum
+	}
+
+	return entropy, nil
+}
+
+/* MnemonicToSeed() derives the 64 bytes BIP-39 seed of a valid mnemonic */
+func MnemonicToSeed(mnemonic string, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -72,6 +73,18 @@ func GenerateRSAKeyPair(keySize int) (publicKey []byte, privateKey []byte) {
 	return publicKey, privateKey
 }
 
+/* TrimDER() removes the zero padding after a DER encoded key stored in a fixed size array */
+func TrimDER(data []byte) []byte {
+	var raw asn1.RawValue
+
+	_, err := asn1.Unmarshal(data, &raw)
+	if err != nil {
+		return data
+	}
+
+	return raw.FullBytes
+}
+
 func NewRandomHash() (result [32]byte) {
 
 	var (
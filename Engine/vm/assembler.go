@@ -0,0 +1,189 @@
+package vm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrAssembly = errors.New("invalid assembly")
+
+/* Assemble() translates a contract to bytecode, one instruction per line. "loop:" emits a JUMPDEST, "PUSH loop" pushes its address, "PUSH 10" pushes the number with the fewest bytes */
+func Assemble(source string) (result []byte, err error) {
+	type line struct {
+		number  int
+		fields  []string
+		address int
+	}
+
+	lines := make([]line, 0)
+	labels := make(map[string]int)
+	address := 0
+
+	for number, text := range strings.Split(source, "\n") {
+		if comment := strings.IndexAny(text, ";#"); comment >= 0 {
+			text = text[:comment]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if label := fields[0]; strings.HasSuffix(label, ":") {
+			label = strings.TrimSuffix(label, ":")
+			if _, exists := labels[label]; exists || len(fields) > 1 || !isLabel(label) {
+				return nil, fmt.Errorf("%w: line %d: bad or duplicate label %s", ErrAssembly, number+1, label)
+			}
+			labels[label] = address
+			fields = []string{JUMPDEST.String()}
+		}
+
+		size, err := instructionSize(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrAssembly, number+1, err.Error())
+		}
+
+		lines = append(lines, line{number: number + 1, fields: fields, address: address})
+		address += size
+	}
+
+	opcodes := Opcodes()
+	result = make([]byte, 0, address)
+
+	for _, instruction := range lines {
+		name := strings.ToUpper(instruction.fields[0])
+		if len(instruction.fields) == 1 {
+			result = append(result, byte(opcodes[name]))
+			continue
+		}
+
+		operand := instruction.fields[1]
+		value, err := parseNumber(operand)
+		if err != nil {
+			target, ok := labels[operand]
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: unknown label %s", ErrAssembly, instruction.number, operand)
+			}
+			value = big.NewInt(int64(target))
+		}
+
+		size := pushSize(name, value, err == nil)
+		data := make([]byte, size)
+		value.FillBytes(data)
+
+		result = append(result, byte(PUSH1)+byte(size-1))
+		result = append(result, data...)
+	}
+
+	return result, nil
+}
+
+/* instructionSize() checks the instruction and returns its size in bytes. Labels always take a PUSH2, so they are known in the first pass */
+func instructionSize(fields []string) (int, error) {
+	name := strings.ToUpper(fields[0])
+	op, ok := Opcodes()[name]
+	if !ok && name != "PUSH" {
+		return 0, fmt.Errorf("unknown instruction %s", fields[0])
+	}
+
+	if name != "PUSH" && op.PushSize() == 0 {
+		if len(fields) != 1 {
+			return 0, fmt.Errorf("%s has no operand", name)
+		}
+		return 1, nil
+	}
+
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("%s needs one operand", name)
+	}
+
+	value, err := parseNumber(fields[1])
+	if err != nil {
+		if !isLabel(fields[1]) {
+			return 0, err
+		}
+		value = big.NewInt(0xffff)
+	}
+
+	size := pushSize(name, value, err == nil)
+	if value.BitLen() > size*8 {
+		return 0, fmt.Errorf("%s does not fit in %d bytes", fields[1], size)
+	}
+
+	return 1 + size, nil
+}
+
+/* pushSize() is the number of data bytes of a PUSH: the explicit size of PUSHn, 2 for labels or the fewest bytes of the number */
+func pushSize(name string, value *big.Int, number bool) int {
+	if name != "PUSH" {
+		return Opcodes()[name].PushSize()
+	}
+
+	if !number {
+		return 2
+	}
+
+	size := (value.BitLen() + 7) / 8
+	if size == 0 {
+		return 1
+	}
+
+	return size
+}
+
+func parseNumber(text string) (*big.Int, error) {
+	if strings.HasPrefix(text, "0x") {
+		data, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid number %s", text)
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	value, ok := new(big.Int).SetString(text, 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid number %s", text)
+	}
+
+	return value, nil
+}
+
+func isLabel(text string) bool {
+	if len(text) == 0 || (text[0] >= '0' && text[0] <= '9') {
+		return false
+	}
+
+	for _, c := range text {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/* Disassemble() lists the instructions of the bytecode with their addresses */
+func Disassemble(code []byte) string {
+	builder := &strings.Builder{}
+
+	for pc := 0; pc < len(code); pc++ {
+		op := Opcode(code[pc])
+		fmt.Fprintf(builder, "%04x %s", pc, op)
+
+		if size := op.PushSize(); size > 0 {
+			end := pc + 1 + size
+			if end > len(code) {
+				end = len(code)
+			}
+			fmt.Fprintf(builder, " 0x%x", code[pc+1:end])
+			pc += size
+		}
+
+		builder.WriteString("\r\n")
+	}
+
+	return builder.String()
+}
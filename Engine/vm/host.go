@@ -0,0 +1,47 @@
+package vm
+
+/* MemoryHost keeps balances and storage in memory, to run contracts offline without a chain */
+type MemoryHost struct {
+	Balances map[Word]uint64
+	Storage  map[Word]map[Word]Word
+}
+
+func NewMemoryHost() *MemoryHost {
+	return &MemoryHost{
+		Balances: make(map[Word]uint64),
+		Storage:  make(map[Word]map[Word]Word),
+	}
+}
+
+func (h *MemoryHost) Balance(address Word) uint64 {
+	return h.Balances[address]
+}
+
+func (h *MemoryHost) Load(contract Word, key Word) Word {
+	return h.Storage[contract][key]
+}
+
+/* Commit() keeps the changes of a successful execution the way the chain does: the value, the storage writes and the transfers */
+func (h *MemoryHost) Commit(context *Context, result *Result) {
+	if result.Err != nil {
+		return
+	}
+
+	h.Balances[context.Address] += context.Value
+
+	if h.Storage[context.Address] == nil {
+		h.Storage[context.Address] = make(map[Word]Word)
+	}
+	for key, value := range result.Storage {
+		if value == (Word{}) {
+			delete(h.Storage[context.Address], key)
+		} else {
+			h.Storage[context.Address][key] = value
+		}
+	}
+
+	for _, transfer := range result.Transfers {
+		h.Balances[context.Address] -= transfer.Ammount
+		h.Balances[transfer.To] += transfer.Ammount
+	}
+}
@@ -0,0 +1,174 @@
+package vm
+
+import "strconv"
+
+type Opcode byte
+
+const (
+	STOP Opcode = 0x00
+	ADD  Opcode = 0x01
+	SUB  Opcode = 0x02
+	MUL  Opcode = 0x03
+	DIV  Opcode = 0x04 // Division by zero is zero
+	MOD  Opcode = 0x05 // Modulo by zero is zero
+
+	LT     Opcode = 0x10
+	GT     Opcode = 0x11
+	EQ     Opcode = 0x12
+	ISZERO Opcode = 0x13
+	AND    Opcode = 0x14
+	OR     Opcode = 0x15
+	XOR    Opcode = 0x16
+	NOT    Opcode = 0x17
+
+	SHA3 Opcode = 0x20 // SHA3-256 of the 32 bytes of the top word
+
+	ADDRESS      Opcode = 0x30 // Address of the running contract
+	BALANCE      Opcode = 0x31 // Balance of the address on the top of the stack
+	CALLER       Opcode = 0x32 // Address of the sender of the transaction
+	CALLVALUE    Opcode = 0x33 // Ammount sent with the transaction
+	CALLDATALOAD Opcode = 0x34 // 32 bytes of the input from the offset on the top of the stack, padded with zeros
+	CALLDATASIZE Opcode = 0x35
+	HEIGHT       Opcode = 0x36 // Id of the block including the transaction
+	TIME         Opcode = 0x37 // Time of the block including the transaction
+
+	POP      Opcode = 0x50
+	SLOAD    Opcode = 0x51
+	SSTORE   Opcode = 0x52 // Pops the key, then the value
+	JUMP     Opcode = 0x53
+	JUMPI    Opcode = 0x54 // Pops the destination, then the condition
+	JUMPDEST Opcode = 0x55 // The only instruction a jump can land on
+	PC       Opcode = 0x56
+	GAS      Opcode = 0x57 // Gas left after this instruction
+
+	PUSH1  Opcode = 0x60 // PUSH1 to PUSH32 push the next 1 to 32 bytes of the code
+	PUSH32 Opcode = 0x7f
+	DUP1   Opcode = 0x80 // DUP1 to DUP16 copy the 1st to 16th word of the stack to the top
+	DUP16  Opcode = 0x8f
+	SWAP1  Opcode = 0x90 // SWAP1 to SWAP16 exchange the top word with the 2nd to 17th
+	SWAP16 Opcode = 0x9f
+	LOG0   Opcode = 0xa0 // LOG0 to LOG4 pop the data word, then 0 to 4 topics
+	LOG4   Opcode = 0xa4
+
+	TRANSFER Opcode = 0xf0 // Pops the address, then the ammount, and sends it from the contract balance
+	RETURN   Opcode = 0xf3 // Stops returning the top word
+	REVERT   Opcode = 0xfd // Stops discarding every change, returning the top word as the reason
+)
+
+/* Gas charged for each instruction */
+const (
+	GasBase     = 2
+	GasVeryLow  = 3
+	GasLow      = 5
+	GasJump     = 8
+	GasSha3     = 30
+	GasBalance  = 100
+	GasSload    = 200
+	GasSstore   = 5000
+	GasLog      = 375
+	GasLogTopic = 375
+	GasTransfer = 2500
+
+	GasTransaction  = 1000 // Paid by every call before running the code
+	GasDeployment   = 5000 // Paid by every deployment before running the code
+	GasPerCodeByte  = 20   // Paid by the deployment for each byte of code stored
+	GasPerInputByte = 4
+)
+
+var opcodeNames = map[Opcode]string{
+	STOP: "STOP", ADD: "ADD", SUB: "SUB", MUL: "MUL", DIV: "DIV", MOD: "MOD",
+	LT: "LT", GT: "GT", EQ: "EQ", ISZERO: "ISZERO", AND: "AND", OR: "OR", XOR: "XOR", NOT: "NOT",
+	SHA3:    "SHA3",
+	ADDRESS: "ADDRESS", BALANCE: "BALANCE", CALLER: "CALLER", CALLVALUE: "CALLVALUE",
+	CALLDATALOAD: "CALLDATALOAD", CALLDATASIZE: "CALLDATASIZE", HEIGHT: "HEIGHT", TIME: "TIME",
+	POP: "POP", SLOAD: "SLOAD", SSTORE: "SSTORE", JUMP: "JUMP", JUMPI: "JUMPI", JUMPDEST: "JUMPDEST", PC: "PC", GAS: "GAS",
+	TRANSFER: "TRANSFER", RETURN: "RETURN", REVERT: "REVERT",
+}
+
+/* Opcodes() returns the value of each instruction name, including the numbered PUSH, DUP, SWAP and LOG */
+func Opcodes() map[string]Opcode {
+	result := make(map[string]Opcode)
+	for op, name := range opcodeNames {
+		result[name] = op
+	}
+
+	for i := 0; i < 32; i++ {
+		result[Opcode(PUSH1+Opcode(i)).String()] = PUSH1 + Opcode(i)
+	}
+
+	for i := 0; i < 16; i++ {
+		result[Opcode(DUP1+Opcode(i)).String()] = DUP1 + Opcode(i)
+		result[Opcode(SWAP1+Opcode(i)).String()] = SWAP1 + Opcode(i)
+	}
+
+	for i := 0; i <= 4; i++ {
+		result[Opcode(LOG0+Opcode(i)).String()] = LOG0 + Opcode(i)
+	}
+
+	return result
+}
+
+func (op Opcode) String() string {
+	switch {
+	case op >= PUSH1 && op <= PUSH32:
+		return "PUSH" + strconv.Itoa(int(op-PUSH1)+1)
+	case op >= DUP1 && op <= DUP16:
+		return "DUP" + strconv.Itoa(int(op-DUP1)+1)
+	case op >= SWAP1 && op <= SWAP16:
+		return "SWAP" + strconv.Itoa(int(op-SWAP1)+1)
+	case op >= LOG0 && op <= LOG4:
+		return "LOG" + strconv.Itoa(int(op-LOG0))
+	}
+
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return "INVALID"
+}
+
+/* PushSize() is the number of bytes of code following a PUSH instruction */
+func (op Opcode) PushSize() int {
+	if op >= PUSH1 && op <= PUSH32 {
+		return int(op-PUSH1) + 1
+	}
+
+	return 0
+}
+
+/* gas() is the fixed gas cost of the instruction */
+func (op Opcode) gas() uint64 {
+	switch {
+	case op >= PUSH1 && op <= SWAP16:
+		return GasVeryLow
+	case op >= LOG0 && op <= LOG4:
+		return GasLog + uint64(op-LOG0)*GasLogTopic
+	}
+
+	switch op {
+	case STOP, RETURN, REVERT:
+		return 0
+	case JUMPDEST:
+		return 1
+	case ADDRESS, CALLER, CALLVALUE, CALLDATASIZE, HEIGHT, TIME, POP, PC, GAS:
+		return GasBase
+	case ADD, SUB, LT, GT, EQ, ISZERO, AND, OR, XOR, NOT, CALLDATALOAD:
+		return GasVeryLow
+	case MUL, DIV, MOD:
+		return GasLow
+	case JUMP, JUMPI:
+		return GasJump
+	case SHA3:
+		return GasSha3
+	case BALANCE:
+		return GasBalance
+	case SLOAD:
+		return GasSload
+	case SSTORE:
+		return GasSstore
+	case TRANSFER:
+		return GasTransfer
+	}
+
+	return 0
+}
@@ -0,0 +1,439 @@
+package vm
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	MaxStackSize = 1024
+	MaxCodeSize  = 16384
+	MaxInputSize = 4096
+)
+
+var (
+	ErrOutOfGas            = errors.New("out of gas")
+	ErrStackUnderflow      = errors.New("stack underflow")
+	ErrStackOverflow       = errors.New("stack overflow")
+	ErrInvalidJump         = errors.New("jump destination is not a JUMPDEST")
+	ErrInvalidOpcode       = errors.New("invalid opcode")
+	ErrReverted            = errors.New("execution reverted")
+	ErrInsufficientBalance = errors.New("contract balance is lower than the transfer")
+	ErrAmountOverflow      = errors.New("transfer ammount is out of range")
+)
+
+type (
+	/* Word of the stack and of the storage. Addresses are words too */
+	Word [32]byte
+
+	/* Host gives the running code read access to the state of the chain. The writes are returned in the Result */
+	Host interface {
+		Balance(address Word) uint64
+		Load(contract Word, key Word) Word
+	}
+
+	Context struct {
+		Address Word   // Contract running the code
+		Caller  Word   // Sender of the transaction
+		Value   uint64 // Ammount sent to the contract with the transaction, already part of its balance for the code
+		Input   []byte
+		Height  uint64
+		Time    uint64
+		Gas     uint64 // Gas available to the code, after the intrinsic gas of the transaction
+	}
+
+	Log struct {
+		Address Word
+		Topics  []Word
+		Data    Word
+	}
+
+	Transfer struct {
+		To      Word
+		Ammount uint64
+	}
+
+	/* Result of an execution. Storage, Logs and Transfers are empty when it fails, nothing it did must be kept */
+	Result struct {
+		GasUsed   uint64
+		Return    []byte
+		Logs      []Log
+		Storage   map[Word]Word // Slots written by the contract and their new values
+		Transfers []Transfer    // Ammounts sent from the contract balance, in order
+		Err       error
+	}
+
+	machine struct {
+		code      []byte
+		context   *Context
+		host      Host
+		gas       uint64
+		stack     []*big.Int
+		jumpdests map[uint64]bool
+		storage   map[Word]Word
+		received  map[Word]uint64
+		sent      uint64
+		logs      []Log
+		transfers []Transfer
+	}
+)
+
+var wordMask = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+/* IntrinsicGas() is the gas a transaction pays before its code runs, for the deployed code or the call input */
+func IntrinsicGas(deployment bool, data []byte) uint64 {
+	if deployment {
+		return GasDeployment + GasPerCodeByte*uint64(len(data))
+	}
+
+	return GasTransaction + GasPerInputByte*uint64(len(data))
+}
+
+/* Execute() runs the code until it stops, returns, reverts, fails or runs out of gas. It has no side effects on the host */
+func Execute(code []byte, context *Context, host Host) (result *Result) {
+	m := &machine{
+		code:      code,
+		context:   context,
+		host:      host,
+		gas:       context.Gas,
+		stack:     make([]*big.Int, 0, 16),
+		jumpdests: jumpDestinations(code),
+		storage:   make(map[Word]Word),
+		received:  make(map[Word]uint64),
+		logs:      make([]Log, 0),
+		transfers: make([]Transfer, 0),
+	}
+
+	returned, err := m.run()
+	result = &Result{GasUsed: context.Gas - m.gas, Return: returned, Err: err}
+
+	if err != nil {
+		if !errors.Is(err, ErrReverted) {
+			result.GasUsed = context.Gas
+		}
+		return result
+	}
+
+	result.Storage = m.storage
+	result.Logs = m.logs
+	result.Transfers = m.transfers
+
+	return result
+}
+
+/* jumpDestinations() finds the JUMPDEST instructions, skipping the data of the PUSH instructions */
+func jumpDestinations(code []byte) map[uint64]bool {
+	result := make(map[uint64]bool)
+
+	for pc := 0; pc < len(code); pc++ {
+		op := Opcode(code[pc])
+		if op == JUMPDEST {
+			result[uint64(pc)] = true
+		}
+		pc += op.PushSize()
+	}
+
+	return result
+}
+
+func (m *machine) run() (returned []byte, err error) {
+	for pc := uint64(0); pc < uint64(len(m.code)); pc++ {
+		op := Opcode(m.code[pc])
+
+		if op.String() == "INVALID" {
+			return nil, ErrInvalidOpcode
+		}
+
+		if m.gas < op.gas() {
+			m.gas = 0
+			return nil, ErrOutOfGas
+		}
+		m.gas -= op.gas()
+
+		switch {
+		case op >= PUSH1 && op <= PUSH32:
+			data := make([]byte, op.PushSize())
+			if pc+1 < uint64(len(m.code)) {
+				copy(data, m.code[pc+1:])
+			}
+			err = m.push(new(big.Int).SetBytes(data))
+			pc += uint64(op.PushSize())
+
+		case op >= DUP1 && op <= DUP16:
+			n := int(op-DUP1) + 1
+			if len(m.stack) < n {
+				return nil, ErrStackUnderflow
+			}
+			err = m.push(new(big.Int).Set(m.stack[len(m.stack)-n]))
+
+		case op >= SWAP1 && op <= SWAP16:
+			n := int(op-SWAP1) + 1
+			if len(m.stack) < n+1 {
+				return nil, ErrStackUnderflow
+			}
+			top := len(m.stack) - 1
+			m.stack[top], m.stack[top-n] = m.stack[top-n], m.stack[top]
+
+		case op >= LOG0 && op <= LOG4:
+			values, err := m.pop(int(op-LOG0) + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			log := Log{Address: m.context.Address, Data: toWord(values[0]), Topics: make([]Word, 0, len(values)-1)}
+			for _, topic := range values[1:] {
+				log.Topics = append(log.Topics, toWord(topic))
+			}
+			m.logs = append(m.logs, log)
+
+		default:
+			var jump bool
+			returned, jump, err = m.step(op, &pc)
+			if err != nil || returned != nil {
+				return returned, err
+			}
+			if op == STOP {
+				return nil, nil
+			}
+			if jump {
+				pc--
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+/* step() runs the instructions without immediate data. jump is true when pc was set to a destination */
+func (m *machine) step(op Opcode, pc *uint64) (returned []byte, jump bool, err error) {
+	switch op {
+	case STOP, JUMPDEST:
+		return nil, false, nil
+
+	case ADD, SUB, MUL, DIV, MOD, LT, GT, EQ, AND, OR, XOR:
+		values, err := m.pop(2)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, m.push(arithmetic(op, values[0], values[1]))
+
+	case ISZERO, NOT, SHA3, BALANCE, CALLDATALOAD, SLOAD:
+		values, err := m.pop(1)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, m.push(m.unary(op, values[0]))
+
+	case ADDRESS:
+		return nil, false, m.push(fromWord(m.context.Address))
+	case CALLER:
+		return nil, false, m.push(fromWord(m.context.Caller))
+	case CALLVALUE:
+		return nil, false, m.push(new(big.Int).SetUint64(m.context.Value))
+	case CALLDATASIZE:
+		return nil, false, m.push(big.NewInt(int64(len(m.context.Input))))
+	case HEIGHT:
+		return nil, false, m.push(new(big.Int).SetUint64(m.context.Height))
+	case TIME:
+		return nil, false, m.push(new(big.Int).SetUint64(m.context.Time))
+	case PC:
+		return nil, false, m.push(new(big.Int).SetUint64(*pc))
+	case GAS:
+		return nil, false, m.push(new(big.Int).SetUint64(m.gas))
+
+	case POP:
+		_, err = m.pop(1)
+		return nil, false, err
+
+	case SSTORE:
+		values, err := m.pop(2)
+		if err != nil {
+			return nil, false, err
+		}
+		m.storage[toWord(values[0])] = toWord(values[1])
+		return nil, false, nil
+
+	case JUMP, JUMPI:
+		count := 1
+		if op == JUMPI {
+			count = 2
+		}
+
+		values, err := m.pop(count)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if op == JUMPI && values[1].Sign() == 0 {
+			return nil, false, nil
+		}
+
+		if !values[0].IsUint64() || !m.jumpdests[values[0].Uint64()] {
+			return nil, false, ErrInvalidJump
+		}
+		*pc = values[0].Uint64()
+		return nil, true, nil
+
+	case TRANSFER:
+		values, err := m.pop(2)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, m.transfer(toWord(values[0]), values[1])
+
+	case RETURN, REVERT:
+		values, err := m.pop(1)
+		if err != nil {
+			return nil, false, err
+		}
+
+		word := toWord(values[0])
+		if op == REVERT {
+			return word[:], false, ErrReverted
+		}
+		return word[:], false, nil
+	}
+
+	return nil, false, ErrInvalidOpcode
+}
+
+func arithmetic(op Opcode, a *big.Int, b *big.Int) (result *big.Int) {
+	result = new(big.Int)
+
+	switch op {
+	case ADD:
+		result.Add(a, b)
+	case SUB:
+		result.Sub(a, b)
+	case MUL:
+		result.Mul(a, b)
+	case DIV:
+		if b.Sign() != 0 {
+			result.Div(a, b)
+		}
+	case MOD:
+		if b.Sign() != 0 {
+			result.Mod(a, b)
+		}
+	case LT:
+		result.SetInt64(boolToInt(a.Cmp(b) < 0))
+	case GT:
+		result.SetInt64(boolToInt(a.Cmp(b) > 0))
+	case EQ:
+		result.SetInt64(boolToInt(a.Cmp(b) == 0))
+	case AND:
+		result.And(a, b)
+	case OR:
+		result.Or(a, b)
+	case XOR:
+		result.Xor(a, b)
+	}
+
+	return result.And(result, wordMask)
+}
+
+func (m *machine) unary(op Opcode, a *big.Int) *big.Int {
+	switch op {
+	case ISZERO:
+		return big.NewInt(boolToInt(a.Sign() == 0))
+	case NOT:
+		return new(big.Int).Xor(a, wordMask)
+	case SHA3:
+		word := toWord(a)
+		hash := sha3.Sum256(word[:])
+		return new(big.Int).SetBytes(hash[:])
+	case BALANCE:
+		return new(big.Int).SetUint64(m.balance(toWord(a)))
+	case CALLDATALOAD:
+		word := Word{}
+		if a.IsUint64() && a.Uint64() < uint64(len(m.context.Input)) {
+			copy(word[:], m.context.Input[a.Uint64():])
+		}
+		return fromWord(word)
+	case SLOAD:
+		key := toWord(a)
+		if value, ok := m.storage[key]; ok {
+			return fromWord(value)
+		}
+		return fromWord(m.host.Load(m.context.Address, key))
+	}
+
+	return new(big.Int)
+}
+
+/* balance() is the balance of the address seen by the code, with the call value and the transfers made so far */
+func (m *machine) balance(address Word) uint64 {
+	result := m.host.Balance(address) + m.received[address]
+	if address == m.context.Address {
+		result += m.context.Value - m.sent
+	}
+
+	return result
+}
+
+func (m *machine) transfer(to Word, ammount *big.Int) error {
+	if !ammount.IsUint64() || ammount.Uint64() > math.MaxInt64 {
+		return ErrAmountOverflow
+	}
+
+	value := ammount.Uint64()
+	if m.balance(m.context.Address) < value {
+		return ErrInsufficientBalance
+	}
+
+	if to != m.context.Address {
+		m.sent += value
+		m.received[to] += value
+	}
+	m.transfers = append(m.transfers, Transfer{To: to, Ammount: value})
+
+	return nil
+}
+
+func (m *machine) push(value *big.Int) error {
+	if len(m.stack) >= MaxStackSize {
+		return ErrStackOverflow
+	}
+
+	m.stack = append(m.stack, value)
+	return nil
+}
+
+/* pop() removes count words and returns them from the top of the stack down */
+func (m *machine) pop(count int) ([]*big.Int, error) {
+	if len(m.stack) < count {
+		return nil, ErrStackUnderflow
+	}
+
+	result := make([]*big.Int, count)
+	for i := range result {
+		result[i] = m.stack[len(m.stack)-1-i]
+	}
+	m.stack = m.stack[:len(m.stack)-count]
+
+	return result, nil
+}
+
+func toWord(value *big.Int) (result Word) {
+	value.FillBytes(result[:])
+	return result
+}
+
+func fromWord(word Word) *big.Int {
+	return new(big.Int).SetBytes(word[:])
+}
+
+func boolToInt(value bool) int64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,327 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	owner    = word(0xa11ce)
+	stranger = word(0xb0b)
+	contract = word(0xc0de)
+)
+
+func word(n uint64) (result Word) {
+	binary.BigEndian.PutUint64(result[24:], n)
+	return result
+}
+
+/* input() encodes the call input, one word per value */
+func input(values ...Word) (result []byte) {
+	for _, value := range values {
+		result = append(result, value[:]...)
+	}
+	return result
+}
+
+func assemble(t *testing.T, source string) []byte {
+	t.Helper()
+
+	code, err := Assemble(source)
+	if err != nil {
+		t.Fatalf("Assemble() failed: %s", err)
+	}
+	return code
+}
+
+func returned(result *Result) uint64 {
+	return new(big.Int).SetBytes(result.Return).Uint64()
+}
+
+func TestGasExhaustion(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		gas  uint64
+	}{
+		{"endless loop", "loop:\nPUSH loop\nJUMP", 1000},
+		{"storage write", "PUSH 1\nPUSH 0\nSSTORE", GasSstore},
+		{"no gas", "PUSH 1", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Execute(assemble(t, test.code), &Context{Address: contract, Gas: test.gas}, NewMemoryHost())
+
+			if !errors.Is(result.Err, ErrOutOfGas) {
+				t.Fatalf("got error %v, want %v", result.Err, ErrOutOfGas)
+			}
+			if result.GasUsed != test.gas {
+				t.Errorf("GasUsed = %d, want all the gas %d", result.GasUsed, test.gas)
+			}
+			if result.Storage != nil || result.Logs != nil || result.Transfers != nil {
+				t.Errorf("a failed execution kept its changes: %+v", result)
+			}
+		})
+	}
+}
+
+func TestRevert(t *testing.T) {
+	source := `
+		PUSH 7
+		PUSH 1
+		SSTORE
+		PUSH 0
+		LOG0
+		PUSH 5
+		PUSH 0x0b0b
+		TRANSFER
+		PUSH 42
+		REVERT`
+
+	host := NewMemoryHost()
+	host.Balances[contract] = 100
+	context := &Context{Address: contract, Caller: owner, Gas: 100000}
+	result := Execute(assemble(t, source), context, host)
+
+	if !errors.Is(result.Err, ErrReverted) {
+		t.Fatalf("got error %v, want %v", result.Err, ErrReverted)
+	}
+	if returned(result) != 42 {
+		t.Errorf("Return = %x, want the revert reason 42", result.Return)
+	}
+	if result.GasUsed == 0 || result.GasUsed >= context.Gas {
+		t.Errorf("GasUsed = %d, a revert pays only the gas it used", result.GasUsed)
+	}
+	if result.Storage != nil || result.Logs != nil || result.Transfers != nil {
+		t.Errorf("a reverted execution kept its changes: %+v", result)
+	}
+
+	host.Commit(context, result)
+	if host.Balances[contract] != 100 || host.Balances[stranger] != 0 || len(host.Storage[contract]) != 0 {
+		t.Errorf("Commit() applied a reverted execution: %+v", host)
+	}
+}
+
+func TestInvalidJump(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		err  error
+	}{
+		// The second byte is the data of the PUSH1, even though it is the JUMPDEST opcode
+		{"into push data", []byte{byte(PUSH1), byte(JUMPDEST), byte(PUSH1), 1, byte(JUMP)}, ErrInvalidJump},
+		{"not a jumpdest", []byte{byte(PUSH1), 3, byte(JUMP), byte(STOP)}, ErrInvalidJump},
+		{"out of the code", []byte{byte(PUSH1), 200, byte(JUMP)}, ErrInvalidJump},
+		{"conditional into push data", []byte{byte(PUSH1), byte(JUMPDEST), byte(PUSH1), 1, byte(PUSH1), 1, byte(JUMPI)}, ErrInvalidJump},
+		{"valid jumpdest", []byte{byte(PUSH1), 3, byte(JUMP), byte(JUMPDEST), byte(STOP)}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Execute(test.code, &Context{Address: contract, Gas: 1000}, NewMemoryHost())
+			if !errors.Is(result.Err, test.err) {
+				t.Errorf("got error %v, want %v", result.Err, test.err)
+			}
+		})
+	}
+}
+
+func TestStackLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"overflow", "loop:\nPUSH 1\nPUSH loop\nJUMP", ErrStackOverflow},
+		{"underflow on add", "PUSH 1\nADD", ErrStackUnderflow},
+		{"underflow on pop", "POP", ErrStackUnderflow},
+		{"underflow on dup", "PUSH 1\nDUP2", ErrStackUnderflow},
+		{"underflow on swap", "PUSH 1\nSWAP1", ErrStackUnderflow},
+		{"underflow on log", "PUSH 1\nLOG1", ErrStackUnderflow},
+		{"underflow on return", "RETURN", ErrStackUnderflow},
+		{"balanced stack", "PUSH 1\nDUP1\nPOP\nSTOP", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context := &Context{Address: contract, Gas: 1000000}
+			result := Execute(assemble(t, test.code), context, NewMemoryHost())
+
+			if !errors.Is(result.Err, test.err) {
+				t.Fatalf("got error %v, want %v", result.Err, test.err)
+			}
+			if test.err != nil && result.GasUsed != context.Gas {
+				t.Errorf("GasUsed = %d, a failure uses all the gas %d", result.GasUsed, context.Gas)
+			}
+		})
+	}
+}
+
+func TestTransferAccounting(t *testing.T) {
+	// Sends word 0 to the stranger and word 1 back to the contract, then returns the contract balance
+	source := `
+		PUSH 0
+		CALLDATALOAD
+		PUSH 0x0b0b
+		TRANSFER
+		PUSH 32
+		CALLDATALOAD
+		ADDRESS
+		TRANSFER
+		ADDRESS
+		BALANCE
+		RETURN`
+
+	tests := []struct {
+		name     string
+		balance  uint64 // Balance of the contract before the call
+		value    uint64
+		sent     uint64
+		self     uint64
+		err      error
+		returned uint64
+	}{
+		{"from the balance", 100, 0, 30, 0, nil, 70},
+		{"from the call value", 0, 50, 50, 0, nil, 0},
+		{"balance and value", 10, 5, 12, 0, nil, 3},
+		{"to itself", 10, 0, 0, 10, nil, 10},
+		{"more than the balance", 10, 5, 16, 0, ErrInsufficientBalance, 0},
+		{"self transfer after sending", 10, 0, 10, 1, ErrInsufficientBalance, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host := NewMemoryHost()
+			host.Balances[contract] = test.balance
+			host.Balances[stranger] = 1
+
+			context := &Context{Address: contract, Caller: owner, Value: test.value, Input: input(word(test.sent), word(test.self)), Gas: 100000}
+			result := Execute(assemble(t, source), context, host)
+
+			if !errors.Is(result.Err, test.err) {
+				t.Fatalf("got error %v, want %v", result.Err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+
+			if returned(result) != test.returned {
+				t.Errorf("contract balance seen by the code = %d, want %d", returned(result), test.returned)
+			}
+
+			host.Commit(context, result)
+			if host.Balances[contract] != test.returned {
+				t.Errorf("contract balance = %d, want %d", host.Balances[contract], test.returned)
+			}
+			if host.Balances[stranger] != 1+test.sent {
+				t.Errorf("stranger balance = %d, want %d", host.Balances[stranger], 1+test.sent)
+			}
+		})
+	}
+}
+
+func TestReceivedBalance(t *testing.T) {
+	// The balance of the recipient includes what the code sent it so far
+	source := `
+		PUSH 4
+		PUSH 0x0b0b
+		TRANSFER
+		PUSH 0x0b0b
+		BALANCE
+		RETURN`
+
+	host := NewMemoryHost()
+	host.Balances[contract] = 10
+	host.Balances[stranger] = 1
+
+	result := Execute(assemble(t, source), &Context{Address: contract, Gas: 100000}, host)
+	if result.Err != nil || returned(result) != 5 {
+		t.Errorf("got %d, %v, want 5", returned(result), result.Err)
+	}
+}
+
+/* example is one call of a contract of the contracts directory. runExamples() commits each call like the chain does */
+type example struct {
+	name     string
+	caller   Word
+	value    uint64
+	input    []byte
+	err      error
+	returned uint64
+	logs     int
+}
+
+func runExamples(t *testing.T, fileName string, examples []example) *MemoryHost {
+	source, err := os.ReadFile(filepath.Join("..", "contracts", fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := assemble(t, string(source))
+
+	host := NewMemoryHost()
+	for _, call := range examples {
+		context := &Context{Address: contract, Caller: call.caller, Value: call.value, Input: call.input, Gas: 100000}
+		result := Execute(code, context, host)
+
+		if !errors.Is(result.Err, call.err) {
+			t.Fatalf("%s: got error %v, want %v", call.name, result.Err, call.err)
+		}
+		if returned(result) != call.returned {
+			t.Errorf("%s: returned %d, want %d", call.name, returned(result), call.returned)
+		}
+		if len(result.Logs) != call.logs {
+			t.Errorf("%s: %d logs, want %d", call.name, len(result.Logs), call.logs)
+		}
+
+		host.Commit(context, result)
+	}
+
+	return host
+}
+
+func TestCounterExample(t *testing.T) {
+	host := runExamples(t, "counter.asm", []example{
+		{name: "deploy", caller: owner},
+		{name: "increment", caller: owner, input: input(word(1)), returned: 1, logs: 1},
+		{name: "increment again", caller: stranger, input: input(word(1)), returned: 2, logs: 1},
+		{name: "read", caller: stranger, input: input(word(0)), returned: 2},
+	})
+
+	if count := host.Storage[contract][word(0)]; count != word(2) {
+		t.Errorf("stored count = %x, want 2", count)
+	}
+}
+
+func TestTokenExample(t *testing.T) {
+	host := runExamples(t, "token.asm", []example{
+		{name: "deploy", caller: owner},
+		{name: "transfer", caller: owner, input: input(word(1), stranger, word(300)), returned: 1, logs: 1},
+		{name: "balance of the recipient", caller: owner, input: input(word(2), stranger), returned: 300},
+		{name: "balance of the deployer", caller: stranger, input: input(word(2), owner), returned: 999700},
+		{name: "insufficient balance", caller: stranger, input: input(word(1), owner, word(301)), err: ErrReverted, returned: 1},
+		{name: "unknown function", caller: owner, input: input(word(3)), err: ErrReverted},
+	})
+
+	if host.Storage[contract][owner] != word(999700) || host.Storage[contract][stranger] != word(300) {
+		t.Errorf("token balances = %x and %x, want 999700 and 300", host.Storage[contract][owner], host.Storage[contract][stranger])
+	}
+}
+
+func TestVaultExample(t *testing.T) {
+	host := runExamples(t, "vault.asm", []example{
+		{name: "deploy", caller: owner},
+		{name: "deposit", caller: stranger, value: 50, input: input(word(0)), returned: 50},
+		{name: "withdraw by a stranger", caller: stranger, input: input(word(1), word(10)), err: ErrReverted, returned: 2},
+		{name: "withdraw too much", caller: owner, input: input(word(1), word(51)), err: ErrInsufficientBalance},
+		{name: "withdraw", caller: owner, input: input(word(1), word(20)), returned: 30, logs: 1},
+	})
+
+	if host.Balances[contract] != 30 || host.Balances[owner] != 20 {
+		t.Errorf("balances = %d and %d, want 30 in the vault and 20 withdrawn", host.Balances[contract], host.Balances[owner])
+	}
+}
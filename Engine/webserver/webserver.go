@@ -2,11 +2,15 @@ package webserver
 
 import (
 	"encoding/json"
+	"engine/blockchain"
 	"engine/utils"
 	"engine/webserver/crud"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -15,7 +19,10 @@ import (
 
 type (
 	WebServer struct {
-		port int
+		port       int
+		walletHost string
+		walletPort int
+		chain      *blockchain.Blockchain // Shared by the requests, see loadChain()
 	}
 
 	Login struct {
@@ -26,14 +33,71 @@ type (
 	JwtToken struct {
 		Token string `json:"token"`
 	}
+
+	VerifyProofRequest struct {
+		Proof blockchain.MerkleProof `json:"proof"`
+		Root  blockchain.HashBlock   `json:"root"`
+	}
+
+	VerifyBalanceRequest struct {
+		Proof blockchain.BalanceProof `json:"proof"`
+		Root  blockchain.HashBlock    `json:"root"`
+	}
+
+	VerifyProofResponse struct {
+		Valid bool `json:"valid"`
+	}
+
+	UnlockRequest struct {
+		Address    string `json:"address"`
+		Passphrase string `json:"passphrase"`
+		Timeout    uint64 `json:"timeout"` // Seconds until the account is locked again. Default is 5 minutes
+	}
+
+	LockRequest struct {
+		Address string `json:"address"` // Locks every account when empty
+	}
+
+	WalletResponse struct {
+		Address  string `json:"address,omitempty"`
+		Unlocked bool   `json:"unlocked"`
+		Expires  string `json:"expires,omitempty"`
+	}
+
+	SendRequest struct {
+		From     string            `json:"from"`
+		To       string            `json:"to"`
+		Ammount  blockchain.Amount `json:"ammount"`
+		Fee      blockchain.Amount `json:"fee"`       // Default is the fee suggested for the key type of the sender
+		LockTime uint64            `json:"lock_time"` // Block height or Unix time before which the transfer cannot be included
+	}
 )
 
+const (
+	DefaultWalletHost = "127.0.0.1"    // The wallet routes take passphrases and spend funds, so they only listen locally unless told otherwise
+	TokenLifetime     = 12 * time.Hour // Validity of the tokens of "/login"
+)
+
+var ErrInvalidToken = errors.New("missing or invalid token. Get one with \"/login\" and send it as \"Authorization: Bearer <token>\"")
+
 var mySignature = []byte{0xa1, 0xae, 0x2a, 0xa1, 0x34, 0x68, 0x04, 0xce, 0xd2, 0xca, 0xa2, 0x95, 0x11, 0x29, 0x13, 0xea, 0x85, 0xc6, 0x9b, 0x8f}
 
 func (w *WebServer) UsePort(port int) {
 	w.port = port
 }
 
+/* UseWallet() sets the interface and the port of the listener of the wallet routes */
+func (w *WebServer) UseWallet(host string, port int) {
+	w.walletHost = host
+	w.walletPort = port
+}
+
+/* loadChain() returns the chain shared by the requests, reloaded when the node changed blocks.dat */
+func (w *WebServer) loadChain() *blockchain.Blockchain {
+	w.chain.Refresh()
+	return w.chain
+}
+
 func setHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -43,6 +107,26 @@ func setHeaders(next http.Handler) http.Handler {
 	})
 }
 
+/* requireToken() rejects the requests without a valid token of "/login" in the Authorization header */
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, ErrInvalidToken
+			}
+			return mySignature, nil
+		})
+		if err != nil || !token.Valid {
+			http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func doLogin(w http.ResponseWriter, r *http.Request) {
 
 	var login Login
@@ -55,6 +139,7 @@ func doLogin(w http.ResponseWriter, r *http.Request) {
 		"email": login.Email,
 		"key":   login.Key,
 		"time":  time.Now(),
+		"exp":   time.Now().Add(TokenLifetime).Unix(),
 		"sign":  utils.EncodeHexString(mySignature),
 	}
 
@@ -88,19 +173,236 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(newUser)
 }
 
+func (ws *WebServer) getMerkleProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	blockId, err := strconv.ParseUint(vars["block"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txHash := &blockchain.HashBlock{}
+	if err := txHash.SetHexString(vars["tx"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	block, err := ws.loadChain().GetBlock(blockId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	proof, err := block.MerkleProof(txHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(proof)
+}
+
+func verifyMerkleProof(w http.ResponseWriter, r *http.Request) {
+
+	var request VerifyProofRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(VerifyProofResponse{Valid: request.Proof.Verify(&request.Root)})
+}
+
+func (ws *WebServer) getBalanceProof(w http.ResponseWriter, r *http.Request) {
+	address, err := blockchain.ParseAddress(mux.Vars(r)["address"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	proof, err := ws.loadChain().BalanceProof(&address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(proof)
+}
+
+func verifyBalanceProof(w http.ResponseWriter, r *http.Request) {
+
+	var request VerifyBalanceRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(VerifyProofResponse{Valid: request.Proof.Verify(&request.Root)})
+}
+
+/* getReceipt() returns the receipt of a transaction included in the main chain */
+func (ws *WebServer) getReceipt(w http.ResponseWriter, r *http.Request) {
+	id := &blockchain.HashBlock{}
+	if err := id.SetHexString(mux.Vars(r)["tx"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := ws.loadChain().Receipt(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(receipt)
+}
+
+/* getOrphans() returns the metrics of the orphan pool of the local node */
+func getOrphans(w http.ResponseWriter, r *http.Request) {
+	metrics, err := blockchain.FetchOrphanMetrics(fmt.Sprintf("127.0.0.1:%d", blockchain.Net().NodePort))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	json.NewEncoder(w).Encode(metrics)
+}
+
+/* unlockAccount() keeps the private key of an account decrypted for the transfers sent with "/send" until the timeout */
+func unlockAccount(w http.ResponseWriter, r *http.Request) {
+
+	var request UnlockRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	address, err := blockchain.ParseAddress(request.Address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = blockchain.Wallet().Unlock(&address, request.Passphrase, time.Duration(request.Timeout)*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	expires, _ := blockchain.Wallet().UnlockedUntil(&address)
+	json.NewEncoder(w).Encode(WalletResponse{Address: request.Address, Unlocked: true, Expires: expires.Format(time.RFC3339)})
+}
+
+func lockAccount(w http.ResponseWriter, r *http.Request) {
+
+	var request LockRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Address) == 0 {
+		blockchain.Wallet().LockAll()
+		json.NewEncoder(w).Encode(WalletResponse{Unlocked: false})
+		return
+	}
+
+	address, err := blockchain.ParseAddress(request.Address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	blockchain.Wallet().Lock(&address)
+	json.NewEncoder(w).Encode(WalletResponse{Address: request.Address, Unlocked: false})
+}
+
+func (ws *WebServer) sendTransaction(w http.ResponseWriter, r *http.Request) {
+
+	var request SendRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := (&blockchain.Account{}).GetAccount(request.From)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bc := ws.loadChain()
+	if request.Fee == 0 {
+		request.Fee = bc.EstimateFeeFor(account.KeyType())
+	}
+
+	transaction, err := bc.NewTransaction(request.From, request.To, request.Ammount, request.Fee, request.LockTime)
+	if errors.Is(err, blockchain.ErrWalletLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(transaction)
+}
+
 func (w *WebServer) Start(started chan bool) {
+	if w.chain == nil {
+		w.chain = &blockchain.Blockchain{}
+	}
+
 	r := mux.NewRouter()
 	r.Use(setHeaders)
 
 	r.HandleFunc("/login", doLogin).Methods("POST")
 	r.HandleFunc("/newuser", createUser).Methods("POST")
+	r.HandleFunc("/merkleproof/{block}/{tx}", w.getMerkleProof).Methods("GET")
+	r.HandleFunc("/verifyproof", verifyMerkleProof).Methods("POST")
+	r.HandleFunc("/balanceproof/{address}", w.getBalanceProof).Methods("GET")
+	r.HandleFunc("/verifybalance", verifyBalanceProof).Methods("POST")
+	r.HandleFunc("/receipt/{tx}", w.getReceipt).Methods("GET")
+	r.HandleFunc("/orphans", getOrphans).Methods("GET")
+
+	// The wallet routes need a token and have their own listener, bound to the loopback interface by default
+	wallet := mux.NewRouter()
+	wallet.Use(setHeaders)
+	wallet.HandleFunc("/login", doLogin).Methods("POST")
+
+	auth := wallet.NewRoute().Subrouter()
+	auth.Use(requireToken)
+	auth.HandleFunc("/wallet/unlock", unlockAccount).Methods("POST")
+	auth.HandleFunc("/wallet/lock", lockAccount).Methods("POST")
+	auth.HandleFunc("/send", w.sendTransaction).Methods("POST")
 
 	started <- true
 
 	if w.port == 0 {
-		w.port = 8080
+		w.port = blockchain.Net().WebPort
+	}
+
+	if len(w.walletHost) == 0 {
+		w.walletHost = DefaultWalletHost
+	}
+
+	if w.walletPort == 0 {
+		w.walletPort = blockchain.Net().WalletPort
 	}
 
+	walletAddress := fmt.Sprintf("%s:%d", w.walletHost, w.walletPort)
+	go func() {
+		log.Printf("Starting wallet webserver on %s...\r\n", walletAddress)
+		log.Fatal(http.ListenAndServe(walletAddress, wallet))
+	}()
+
 	tcpipAddress := fmt.Sprintf(":%d", w.port)
 
 	log.Printf("Starting webserver on %s...\r\n", tcpipAddress)